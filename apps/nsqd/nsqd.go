@@ -97,6 +97,7 @@ func nsqdFlagSet(opts *nsqd.Options) *flag.FlagSet {
 	flagSet.Var(&lookupdTCPAddrs, "lookupd-tcp-address", "lookupd TCP address (may be given multiple times)")
 	flagSet.Duration("http-client-connect-timeout", opts.HTTPClientConnectTimeout, "timeout for HTTP connect")
 	flagSet.Duration("http-client-request-timeout", opts.HTTPClientRequestTimeout, "timeout for HTTP request")
+	flagSet.Duration("drain-duration", opts.DrainDuration, "duration to keep serving HTTP(S), with /stats reporting draining, after the TCP listener is closed on exit (0 to exit immediately)")
 
 	// diskqueue options
 	flagSet.String("data-path", opts.DataPath, "path to store disk-backed messages")
@@ -111,6 +112,7 @@ func nsqdFlagSet(opts *nsqd.Options) *flag.FlagSet {
 	flagSet.Int64("max-msg-size", opts.MaxMsgSize, "maximum size of a single message in bytes")
 	flagSet.Duration("max-req-timeout", opts.MaxReqTimeout, "maximum requeuing timeout for a message")
 	flagSet.Int64("max-body-size", opts.MaxBodySize, "maximum size of a single command body")
+	flagSet.Int64("max-attempts", opts.MaxAttempts, "maximum number of delivery attempts before a message is discarded (0 for unlimited)")
 
 	// client overridable configuration options
 	flagSet.Duration("max-heartbeat-interval", opts.MaxHeartbeatInterval, "maximum client configurable duration of time between client heartbeats")
@@ -118,6 +120,25 @@ func nsqdFlagSet(opts *nsqd.Options) *flag.FlagSet {
 	flagSet.Int64("max-output-buffer-size", opts.MaxOutputBufferSize, "maximum client configurable size (in bytes) for a client output buffer")
 	flagSet.Duration("max-output-buffer-timeout", opts.MaxOutputBufferTimeout, "maximum client configurable duration of time between flushing to a client")
 
+	// degraded threshold options
+	flagSet.Int64("degraded-min-free-bytes", opts.DegradedMinFreeBytes, "report degraded when --data-path has less than this many bytes free (0 to disable)")
+	flagSet.Int("degraded-max-goroutines", opts.DegradedMaxGoroutines, "report degraded when more than this many goroutines are running (0 to disable)")
+
+	statsClusterNodes := app.StringArray{}
+	flagSet.Var(&statsClusterNodes, "stats-cluster-node", "nsqd HTTP <addr>:<port> to merge into /stats/cluster (may be given multiple times)")
+	flagSet.Duration("client-count-window", opts.ClientCountWindow, "duration of time over which channel min/max client counts are tracked")
+	flagSet.Float64("depth-ewma-alpha", opts.DepthEWMAAlpha, "smoothing factor (0, 1] of the channel depth moving average, sampled every second (1 is no smoothing)")
+	flagSet.Int("stats-history-size", opts.StatsHistorySize, "number of stats snapshots kept for /stats/history (0 to disable)")
+	flagSet.Duration("stats-history-interval", opts.StatsHistoryInterval, "duration of time between stats snapshots kept for /stats/history")
+	flagSet.Duration("quiet-topic-threshold", opts.QuietTopicThreshold, "report topics that have not received a message for this duration of time as quiet (0 to disable)")
+	flagSet.Float64("quality-score-idle-weight", opts.QualityScoreIdleWeight, "weight of time since the last command in the client quality score")
+	flagSet.Float64("quality-score-write-error-weight", opts.QualityScoreWriteErrorWeight, "weight of write errors in the client quality score")
+	flagSet.Float64("quality-score-rdy-weight", opts.QualityScoreRdyWeight, "weight of RDY utilization (in-flight / RDY) in the client quality score")
+	flagSet.Float64("quality-score-near-timeout-weight", opts.QualityScoreNearTimeoutWeight, "weight of in-flight messages near their timeout in the client quality score")
+	flagSet.Int64("alert-depth-threshold", opts.AlertDepthThreshold, "report topics and channels deeper than this in /stats/alerts (0 to disable)")
+	flagSet.Duration("alert-age-threshold", opts.AlertAgeThreshold, "report channels whose oldest in-flight message was published longer ago than this in /stats/alerts (0 to disable)")
+	flagSet.Float64("alert-timeout-rate-threshold", opts.AlertTimeoutRateThreshold, "report channels timing out more messages per second (over the last minute) than this in /stats/alerts (0 to disable)")
+
 	// statsd integration options
 	flagSet.String("statsd-address", opts.StatsdAddress, "UDP <addr>:<port> of a statsd daemon for pushing stats")
 	flagSet.Duration("statsd-interval", opts.StatsdInterval, "duration between pushing to statsd")
@@ -128,6 +149,10 @@ func nsqdFlagSet(opts *nsqd.Options) *flag.FlagSet {
 	e2eProcessingLatencyPercentiles := app.FloatArray{}
 	flagSet.Var(&e2eProcessingLatencyPercentiles, "e2e-processing-latency-percentile", "message processing time percentiles (as float (0, 1.0]) to track (can be specified multiple times or comma separated '1.0,0.99,0.95', default none)")
 	flagSet.Duration("e2e-processing-latency-window-time", opts.E2EProcessingLatencyWindowTime, "calculate end to end latency quantiles for this duration of time (ie: 60s would only show quantile calculations from the past 60 seconds)")
+	flagSet.Bool("dwell-time", opts.DwellTimeEnabled, "track channel dwell time (enqueue to finish) quantiles, using the e2e processing latency percentiles and window time")
+	flagSet.Bool("dispatch-latency", opts.DispatchLatencyEnabled, "track channel dispatch latency (deliverable to sent to a client) quantiles, using the e2e processing latency percentiles and window time")
+	flagSet.Bool("ack-latency", opts.AckLatencyEnabled, "track per-client ack latency (sent to FIN) quantiles, using the e2e processing latency percentiles and window time")
+	flagSet.Int("stats-quantile-digits", opts.StatsQuantileDigits, "round quantile values in /stats output to this many significant digits (0 = unrounded)")
 
 	// TLS config
 	flagSet.String("tls-cert", opts.TLSCert, "path to certificate file")
@@ -231,6 +256,7 @@ func (p *program) Start() error {
 		log.Fatalf("ERROR: failed to persist metadata - %s", err.Error())
 	}
 	nsqd.Main()
+	handleStatsSnapshotSignal(nsqd)
 
 	p.nsqd = nsqd
 	return nil
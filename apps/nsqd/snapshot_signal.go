@@ -0,0 +1,28 @@
+// +build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nsqio/nsq/nsqd"
+)
+
+// handleStatsSnapshotSignal writes a stats snapshot whenever SIGUSR1 is received
+func handleStatsSnapshotSignal(n *nsqd.NSQD) {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGUSR1)
+	go func() {
+		for range signalChan {
+			fileName, err := n.WriteStatsSnapshot()
+			if err != nil {
+				log.Printf("ERROR: failed to write stats snapshot - %s", err)
+				continue
+			}
+			log.Printf("wrote stats snapshot to %s", fileName)
+		}
+	}()
+}
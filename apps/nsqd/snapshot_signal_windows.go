@@ -0,0 +1,11 @@
+// +build windows
+
+package main
+
+import (
+	"github.com/nsqio/nsq/nsqd"
+)
+
+// handleStatsSnapshotSignal is a no-op, there is no SIGUSR1 on windows (use
+// POST /stats/snapshot instead)
+func handleStatsSnapshotSignal(n *nsqd.NSQD) {}
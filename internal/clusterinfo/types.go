@@ -249,6 +249,14 @@ func (c ChannelStatsByHost) Less(i, j int) bool {
 	return c.ChannelStatsList[i].Hostname < c.ChannelStatsList[j].Hostname
 }
 
+type ChannelStatsByName struct {
+	ChannelStatsList
+}
+
+func (c ChannelStatsByName) Less(i, j int) bool {
+	return c.ChannelStatsList[i].ChannelName < c.ChannelStatsList[j].ChannelName
+}
+
 type ClientStatsList []*ClientStats
 
 func (c ClientStatsList) Len() int      { return len(c) }
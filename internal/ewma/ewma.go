@@ -0,0 +1,71 @@
+package ewma
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const tickInterval = 5 * time.Second
+
+// Rate is an exponentially weighted moving average of events per second.
+//
+// Updates are a single atomic add so that it is cheap to call on hot paths,
+// the average is only advanced (in whole tickInterval steps) when it is read.
+// Any ticks that elapse without updates decay the rate towards zero.
+type Rate struct {
+	// 64bit atomic vars need to be first for proper alignment on 32bit platforms
+	uncounted int64
+
+	sync.Mutex
+	rate     float64
+	init     bool
+	alpha    float64
+	lastTick time.Time
+}
+
+// NewRate returns a Rate that averages over (roughly) the given window, ie.
+// a window of 1m behaves like the 1 minute unix load average.
+func NewRate(window time.Duration) *Rate {
+	return &Rate{
+		alpha:    1 - math.Exp(-float64(tickInterval)/float64(window)),
+		lastTick: time.Now(),
+	}
+}
+
+// Update records n events
+func (r *Rate) Update(n int64) {
+	atomic.AddInt64(&r.uncounted, n)
+}
+
+// Rate returns the current per-second rate
+func (r *Rate) Rate() float64 {
+	if r == nil {
+		return 0
+	}
+	return r.rateAt(time.Now())
+}
+
+func (r *Rate) rateAt(now time.Time) float64 {
+	r.Lock()
+	defer r.Unlock()
+
+	ticks := int64(now.Sub(r.lastTick) / tickInterval)
+	if ticks <= 0 {
+		return r.rate
+	}
+	r.lastTick = r.lastTick.Add(time.Duration(ticks) * tickInterval)
+
+	// the events since the last read are spread evenly across the elapsed ticks
+	count := atomic.SwapInt64(&r.uncounted, 0)
+	instant := float64(count) / (float64(ticks) * tickInterval.Seconds())
+	if !r.init {
+		r.rate = instant
+		r.init = true
+		ticks--
+	}
+	// closed form of applying `rate += alpha * (instant - rate)` once per tick
+	r.rate = instant + (r.rate-instant)*math.Pow(1-r.alpha, float64(ticks))
+	return r.rate
+}
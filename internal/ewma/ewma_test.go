@@ -0,0 +1,42 @@
+package ewma
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nsqio/nsq/internal/test"
+)
+
+func TestRate(t *testing.T) {
+	r := NewRate(time.Minute)
+	start := r.lastTick
+
+	test.Equal(t, float64(0), r.rateAt(start))
+
+	// nothing is counted until a full tick has elapsed
+	r.Update(50)
+	test.Equal(t, float64(0), r.rateAt(start.Add(tickInterval/2)))
+
+	// the first tick seeds the average
+	test.Equal(t, float64(10), r.rateAt(start.Add(tickInterval)))
+
+	// a steady rate converges on itself
+	for i := 2; i <= 100; i++ {
+		r.Update(50)
+		r.rateAt(start.Add(time.Duration(i) * tickInterval))
+	}
+	if rate := r.rateAt(start.Add(100 * tickInterval)); rate < 9.9 || rate > 10.1 {
+		t.Fatalf("rate %f not ~10", rate)
+	}
+
+	// idle ticks decay the average towards zero
+	rate := r.rateAt(start.Add(200 * tickInterval))
+	if rate > 0.01 {
+		t.Fatalf("rate %f did not decay", rate)
+	}
+}
+
+func TestRateNil(t *testing.T) {
+	var r *Rate
+	test.Equal(t, float64(0), r.Rate())
+}
@@ -71,6 +71,11 @@ func RespondV1(w http.ResponseWriter, code int, data interface{}) {
 	var err error
 	var isJSON bool
 
+	if code == http.StatusNotModified {
+		w.WriteHeader(code)
+		return
+	}
+
 	if code == 200 {
 		switch data.(type) {
 		case string:
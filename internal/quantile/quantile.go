@@ -1,6 +1,7 @@
 package quantile
 
 import (
+	"math"
 	"strings"
 	"sync"
 	"time"
@@ -22,10 +23,45 @@ func (r *Result) String() string {
 	return strings.Join(s, ", ")
 }
 
+// Round rounds each percentile value to the given number of significant
+// digits (a no-op for digits <= 0)
+func (r *Result) Round(digits int) {
+	if r == nil || digits <= 0 {
+		return
+	}
+	for _, item := range r.Percentiles {
+		item["value"] = roundSignificant(item["value"], digits)
+	}
+}
+
+func roundSignificant(v float64, digits int) float64 {
+	if v == 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return v
+	}
+	neg := v < 0
+	if neg {
+		v = -v
+	}
+	// scale by a power of ten that is exactly representable so that values
+	// rounded to integers stay integers
+	exp := digits - int(math.Ceil(math.Log10(v)))
+	if exp >= 0 {
+		pow := math.Pow10(exp)
+		v = math.Floor(v*pow+0.5) / pow
+	} else {
+		pow := math.Pow10(-exp)
+		v = math.Floor(v/pow+0.5) * pow
+	}
+	if neg {
+		v = -v
+	}
+	return v
+}
+
 type Quantile struct {
 	sync.Mutex
-	streams        [2]quantile.Stream
-	currentIndex   uint8
+	streams        []quantile.Stream
+	currentIndex   int
 	lastMoveWindow time.Time
 	currentStream  *quantile.Stream
 
@@ -34,17 +70,69 @@ type Quantile struct {
 }
 
 func New(WindowTime time.Duration, Percentiles []float64) *Quantile {
+	return NewWithSubWindows(WindowTime, 2, Percentiles)
+}
+
+// NewWithSubWindows returns a Quantile over WindowTime that is made up of
+// subWindows streams, the oldest of which is discarded every
+// WindowTime/subWindows. More sub-windows make the window slide more smoothly.
+func NewWithSubWindows(WindowTime time.Duration, subWindows int, Percentiles []float64) *Quantile {
 	q := Quantile{
-		currentIndex:   0,
-		lastMoveWindow: time.Now(),
-		MoveWindowTime: WindowTime / 2,
-		Percentiles:    Percentiles,
+		Percentiles: Percentiles,
+	}
+	q.reset(WindowTime, subWindows)
+	return &q
+}
+
+// SetWindow changes the window (and number of sub-windows), discarding all
+// samples collected so far
+func (q *Quantile) SetWindow(WindowTime time.Duration, subWindows int) {
+	if q == nil {
+		return
+	}
+	q.Lock()
+	q.reset(WindowTime, subWindows)
+	q.Unlock()
+}
+
+// Reset discards all samples collected so far, keeping the window
+func (q *Quantile) Reset() {
+	if q == nil {
+		return
 	}
-	for i := 0; i < 2; i++ {
-		q.streams[i] = *quantile.NewTargeted(Percentiles...)
+	q.Lock()
+	for i := range q.streams {
+		q.streams[i].Reset()
+	}
+	q.Unlock()
+}
+
+// Window returns the window and number of sub-windows
+func (q *Quantile) Window() (time.Duration, int) {
+	if q == nil {
+		return 0, 0
 	}
+	q.Lock()
+	defer q.Unlock()
+	return q.MoveWindowTime * time.Duration(len(q.streams)), len(q.streams)
+}
+
+func (q *Quantile) reset(WindowTime time.Duration, subWindows int) {
+	if subWindows < 1 {
+		subWindows = 1
+	}
+	q.streams = make([]quantile.Stream, subWindows)
+	for i := range q.streams {
+		q.streams[i] = *quantile.NewTargeted(q.Percentiles...)
+	}
+	q.currentIndex = 0
 	q.currentStream = &q.streams[0]
-	return &q
+	q.lastMoveWindow = time.Now()
+	q.MoveWindowTime = WindowTime / time.Duration(subWindows)
+	if q.MoveWindowTime <= 0 {
+		// the window would never stop being stale
+		q.MoveWindowTime = 1
+	}
 }
 
 func (q *Quantile) Result() *Result {
@@ -67,9 +155,7 @@ func (q *Quantile) Insert(msgStartTime int64) {
 	q.Lock()
 
 	now := time.Now()
-	for q.IsDataStale(now) {
-		q.moveWindow()
-	}
+	q.advance(now)
 
 	q.currentStream.Insert(float64(now.UnixNano() - msgStartTime))
 	q.Unlock()
@@ -77,18 +163,51 @@ func (q *Quantile) Insert(msgStartTime int64) {
 
 func (q *Quantile) QueryHandler() *quantile.Stream {
 	q.Lock()
-	now := time.Now()
-	for q.IsDataStale(now) {
-		q.moveWindow()
-	}
+	q.advance(time.Now())
 
 	merged := quantile.NewTargeted(q.Percentiles...)
-	merged.Merge(q.streams[0].Samples())
-	merged.Merge(q.streams[1].Samples())
+	for i := range q.streams {
+		merged.Merge(q.streams[i].Samples())
+	}
 	q.Unlock()
 	return merged
 }
 
+// Sample is a value (in ns) held by the underlying stream, Width is the number
+// of inserted values it stands in for
+type Sample struct {
+	Value float64 `json:"value"`
+	Width float64 `json:"width"`
+}
+
+// Samples returns the samples held across all sub-windows (ie. for at most the
+// window) and the total number held. When there are more than max, an evenly
+// spaced subset of max samples is returned.
+func (q *Quantile) Samples(max int) ([]Sample, int) {
+	if q == nil {
+		return []Sample{}, 0
+	}
+	q.Lock()
+	q.advance(time.Now())
+
+	var all quantile.Samples
+	for i := range q.streams {
+		all = append(all, q.streams[i].Samples()...)
+	}
+	q.Unlock()
+
+	n := len(all)
+	if max > n {
+		max = n
+	}
+	samples := make([]Sample, max)
+	for i := range samples {
+		s := all[i*n/max]
+		samples[i] = Sample{Value: s.Value, Width: s.Width}
+	}
+	return samples, n
+}
+
 func (q *Quantile) IsDataStale(now time.Time) bool {
 	return now.After(q.lastMoveWindow.Add(q.MoveWindowTime))
 }
@@ -96,14 +215,19 @@ func (q *Quantile) IsDataStale(now time.Time) bool {
 func (q *Quantile) Merge(them *Quantile) {
 	q.Lock()
 	them.Lock()
-	iUs := q.currentIndex
-	iThem := them.currentIndex
-
-	q.streams[iUs].Merge(them.streams[iThem].Samples())
-
-	iUs ^= 0x1
-	iThem ^= 0x1
-	q.streams[iUs].Merge(them.streams[iThem].Samples())
+	// merge newest to oldest, if they have more sub-windows than we do their
+	// older samples all end up in our oldest sub-window
+	nUs := len(q.streams)
+	nThem := len(them.streams)
+	for i := 0; i < nThem; i++ {
+		iUs := i
+		if iUs > nUs-1 {
+			iUs = nUs - 1
+		}
+		iUs = (q.currentIndex - iUs + nUs) % nUs
+		iThem := (them.currentIndex - i + nThem) % nThem
+		q.streams[iUs].Merge(them.streams[iThem].Samples())
+	}
 
 	if q.lastMoveWindow.Before(them.lastMoveWindow) {
 		q.lastMoveWindow = them.lastMoveWindow
@@ -112,8 +236,21 @@ func (q *Quantile) Merge(them *Quantile) {
 	them.Unlock()
 }
 
+// advance moves the window on to now, once every sub-window has been moved
+// past (and so discarded) it skips straight to the sub-window now falls in
+func (q *Quantile) advance(now time.Time) {
+	for i := 0; q.IsDataStale(now); i++ {
+		if i == len(q.streams) {
+			elapsed := now.Sub(q.lastMoveWindow)
+			q.lastMoveWindow = q.lastMoveWindow.Add(elapsed - elapsed%q.MoveWindowTime)
+			return
+		}
+		q.moveWindow()
+	}
+}
+
 func (q *Quantile) moveWindow() {
-	q.currentIndex ^= 0x1
+	q.currentIndex = (q.currentIndex + 1) % len(q.streams)
 	q.currentStream = &q.streams[q.currentIndex]
 	q.lastMoveWindow = q.lastMoveWindow.Add(q.MoveWindowTime)
 	q.currentStream.Reset()
@@ -0,0 +1,113 @@
+package quantile
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nsqio/nsq/internal/test"
+)
+
+// subWindowCounts returns the number of samples in each of q's sub-windows,
+// newest first
+func subWindowCounts(q *Quantile) []int {
+	n := len(q.streams)
+	counts := make([]int, n)
+	for i := range counts {
+		counts[i] = q.streams[(q.currentIndex-i+n)%n].Count()
+	}
+	return counts
+}
+
+// newFilled returns a Quantile with subWindows sub-windows that each hold one
+// sample
+func newFilled(subWindows int) *Quantile {
+	q := NewWithSubWindows(time.Minute, subWindows, []float64{0.99})
+	for i := 0; i < subWindows; i++ {
+		if i > 0 {
+			q.moveWindow()
+		}
+		q.Insert(time.Now().Add(-time.Millisecond).UnixNano())
+	}
+	return q
+}
+
+func TestQuantileRolloverOneSubWindow(t *testing.T) {
+	q := NewWithSubWindows(time.Minute, 1, []float64{0.99})
+	q.Insert(time.Now().Add(-time.Millisecond).UnixNano())
+	test.Equal(t, 1, q.Result().Count)
+
+	q.lastMoveWindow = q.lastMoveWindow.Add(-time.Minute - time.Millisecond)
+	test.Equal(t, 0, q.Result().Count)
+}
+
+func TestQuantileRolloverSubWindows(t *testing.T) {
+	q := NewWithSubWindows(3*time.Minute, 3, []float64{0.99})
+	q.Insert(time.Now().Add(-time.Millisecond).UnixNano())
+
+	// one sub-window on the sample is still within the window
+	q.lastMoveWindow = q.lastMoveWindow.Add(-time.Minute - time.Millisecond)
+	q.Insert(time.Now().Add(-time.Millisecond).UnixNano())
+	test.Equal(t, []int{1, 1, 0}, subWindowCounts(q))
+	test.Equal(t, 2, q.Result().Count)
+
+	// two more and the first sample has gone
+	q.lastMoveWindow = q.lastMoveWindow.Add(-2*time.Minute - time.Millisecond)
+	test.Equal(t, 1, q.Result().Count)
+	test.Equal(t, []int{0, 0, 1}, subWindowCounts(q))
+
+	// an idle period of many windows discards everything without moving
+	// through each sub-window
+	q.lastMoveWindow = q.lastMoveWindow.Add(-time.Hour)
+	test.Equal(t, 0, q.Result().Count)
+	test.Equal(t, false, q.IsDataStale(time.Now()))
+}
+
+func TestQuantileZeroMoveWindowTime(t *testing.T) {
+	q := NewWithSubWindows(time.Nanosecond, 2, []float64{0.99})
+	test.Equal(t, time.Duration(1), q.MoveWindowTime)
+
+	// would spin for ever if the window never stopped being stale
+	time.Sleep(time.Millisecond)
+	q.Insert(time.Now().UnixNano())
+	test.Equal(t, 1, q.streams[q.currentIndex].Count())
+}
+
+func TestQuantileSetWindow(t *testing.T) {
+	q := newFilled(2)
+	test.Equal(t, 2, q.Result().Count)
+
+	q.SetWindow(2*time.Minute, 4)
+	test.Equal(t, 0, q.Result().Count)
+	windowTime, subWindows := q.Window()
+	test.Equal(t, 2*time.Minute, windowTime)
+	test.Equal(t, 4, subWindows)
+	test.Equal(t, 30*time.Second, q.MoveWindowTime)
+}
+
+func TestQuantileMerge(t *testing.T) {
+	for _, tc := range []struct {
+		nUs, nThem int
+		counts     []int
+	}{
+		// their older samples all end up in our oldest sub-window
+		{2, 4, []int{1, 3}},
+		{3, 3, []int{1, 1, 1}},
+		{4, 2, []int{1, 1, 0, 0}},
+	} {
+		q := NewWithSubWindows(time.Minute, tc.nUs, []float64{0.99})
+		q.Merge(newFilled(tc.nThem))
+		test.Equal(t, tc.counts, subWindowCounts(q))
+		test.Equal(t, tc.nThem, q.Result().Count)
+	}
+}
+
+func TestQuantileNil(t *testing.T) {
+	var q *Quantile
+	windowTime, subWindows := q.Window()
+	test.Equal(t, time.Duration(0), windowTime)
+	test.Equal(t, 0, subWindows)
+	test.Equal(t, 0, q.Result().Count)
+	samples, n := q.Samples(10)
+	test.Equal(t, 0, len(samples))
+	test.Equal(t, 0, n)
+}
@@ -3,6 +3,8 @@ package nsqd
 import (
 	"bytes"
 	"container/heap"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"math"
 	"strings"
@@ -41,6 +43,59 @@ type Channel struct {
 	inFlightCount uint64
 	deferredCount uint64
 
+	maxAttemptsExceededCount uint64
+	emptyStateChangedAt      int64
+	pausedAt                 int64
+
+	// messages sent to clients straight from memoryMsgChan vs. read back from
+	// the backend
+	inMemoryDeliveredCount uint64
+	backendDeliveredCount  uint64
+
+	// float64 bits of the depth moving average, see updateDepthEWMA
+	depthEWMA uint64
+
+	// in-flight messages on their second or later attempt, only updated under
+	// inFlightMutex
+	retriedInFlightCount int64
+
+	// messages discarded by Empty()
+	emptiedMessageCount uint64
+
+	// total timeout extension (in ns) granted by TouchMessage
+	touchedNanos int64
+
+	// subscribed clients whose connection ended in an error (read, write or
+	// fatal protocol error) rather than a clean close
+	abnormalDisconnectCount uint64
+
+	// highest message ID (as a guid) delivered so far and deliveries of a
+	// lower one after it, see recordDeliveryOrder
+	maxDeliveredID          uint64
+	outOfOrderDeliveryCount uint64
+
+	// REQs whose timeout was clamped to --max-req-timeout
+	deferredClampedCount uint64
+
+	// RDY counts over --max-rdy-count, which are rejected (closing the
+	// connection) rather than clamped
+	rdyRejectedCount uint64
+
+	// RDY commands that changed a subscribed client's RDY after its first one
+	rdyChangeCount uint64
+
+	// depths as of the last sampleDepth, used by approximate stats
+	sampledDepth        int64
+	sampledBackendDepth int64
+
+	// size (see messageSize) of the messages in memoryMsgChan
+	memoryBytes int64
+
+	// sum of (and number of) sampled depths, samples are depthSampleInterval
+	// apart so their mean is the time-weighted average depth
+	depthSampleSum   int64
+	depthSampleCount int64
+
 	sync.RWMutex
 
 	topicName string
@@ -62,6 +117,15 @@ type Channel struct {
 
 	// Stats tracking
 	e2eProcessingLatencyStream *quantile.Quantile
+	dwellTimeStream            *quantile.Quantile
+	dispatchLatencyStream      *quantile.Quantile
+	isEmpty                    int32
+	emptyStateMutex            sync.Mutex
+	clientCountHistory         clientCountHistory
+	timeoutTrend               rateTrend
+	lastError                  lastError
+	depthEWMAInit              int32
+	hadClient                  int32
 
 	// TODO: these can be DRYd up
 	deferredMessages map[MessageID]*pqueue.Item
@@ -83,12 +147,26 @@ func NewChannel(topicName string, channelName string, ctx *context,
 		clients:        make(map[int64]Consumer),
 		deleteCallback: deleteCallback,
 		ctx:            ctx,
+
+		emptyStateChangedAt: time.Now().UnixNano(),
 	}
 	if len(ctx.nsqd.getOpts().E2EProcessingLatencyPercentiles) > 0 {
 		c.e2eProcessingLatencyStream = quantile.New(
 			ctx.nsqd.getOpts().E2EProcessingLatencyWindowTime,
 			ctx.nsqd.getOpts().E2EProcessingLatencyPercentiles,
 		)
+		if ctx.nsqd.getOpts().DwellTimeEnabled {
+			c.dwellTimeStream = quantile.New(
+				ctx.nsqd.getOpts().E2EProcessingLatencyWindowTime,
+				ctx.nsqd.getOpts().E2EProcessingLatencyPercentiles,
+			)
+		}
+		if ctx.nsqd.getOpts().DispatchLatencyEnabled {
+			c.dispatchLatencyStream = quantile.New(
+				ctx.nsqd.getOpts().E2EProcessingLatencyWindowTime,
+				ctx.nsqd.getOpts().E2EProcessingLatencyPercentiles,
+			)
+		}
 	}
 
 	c.initPQ()
@@ -114,6 +192,7 @@ func NewChannel(topicName string, channelName string, ctx *context,
 			dqLogf,
 		)
 	}
+	c.updateEmptyState()
 
 	c.ctx.nsqd.Notify(c)
 
@@ -125,6 +204,7 @@ func (c *Channel) initPQ() {
 
 	c.inFlightMutex.Lock()
 	atomic.StoreUint64(&c.inFlightCount, 0)
+	atomic.StoreInt64(&c.retriedInFlightCount, 0)
 	c.inFlightMessages = make(map[MessageID]*Message)
 	c.inFlightPQ = newInFlightPqueue(pqSize)
 	c.inFlightMutex.Unlock()
@@ -191,6 +271,8 @@ func (c *Channel) Empty() error {
 	c.Lock()
 	defer c.Unlock()
 
+	// everything discarded, ie. in-flight, deferred, in memory and backend
+	emptied := atomic.LoadUint64(&c.inFlightCount) + atomic.LoadUint64(&c.deferredCount)
 	c.initPQ()
 	for _, client := range c.clients {
 		client.Empty()
@@ -198,14 +280,23 @@ func (c *Channel) Empty() error {
 
 	for {
 		select {
-		case <-c.memoryMsgChan:
+		case msg := <-c.memoryMsgChan:
+			atomic.AddInt64(&c.memoryBytes, -messageSize(msg))
+			emptied++
 		default:
 			goto finish
 		}
 	}
 
 finish:
-	return c.backend.Empty()
+	backendDepth := c.backend.Depth()
+	err := c.backend.Empty()
+	if err == nil {
+		emptied += uint64(backendDepth)
+	}
+	atomic.AddUint64(&c.emptiedMessageCount, emptied)
+	c.updateEmptyState()
+	return err
 }
 
 // flush persists all the messages in internal memory buffers to the backend
@@ -221,8 +312,10 @@ func (c *Channel) flush() error {
 	for {
 		select {
 		case msg := <-c.memoryMsgChan:
+			atomic.AddInt64(&c.memoryBytes, -messageSize(msg))
 			err := writeMessageToBackend(&msgBuf, msg, c.backend)
 			if err != nil {
+				c.lastError.set(err)
 				c.ctx.nsqd.logf(LOG_ERROR, "failed to write message to backend - %s", err)
 			}
 		default:
@@ -235,6 +328,7 @@ finish:
 	for _, msg := range c.inFlightMessages {
 		err := writeMessageToBackend(&msgBuf, msg, c.backend)
 		if err != nil {
+			c.lastError.set(err)
 			c.ctx.nsqd.logf(LOG_ERROR, "failed to write message to backend - %s", err)
 		}
 	}
@@ -245,6 +339,7 @@ finish:
 		msg := item.Value.(*Message)
 		err := writeMessageToBackend(&msgBuf, msg, c.backend)
 		if err != nil {
+			c.lastError.set(err)
 			c.ctx.nsqd.logf(LOG_ERROR, "failed to write message to backend - %s", err)
 		}
 	}
@@ -268,8 +363,10 @@ func (c *Channel) UnPause() error {
 func (c *Channel) doPause(pause bool) error {
 	if pause {
 		atomic.StoreInt32(&c.paused, 1)
+		atomic.CompareAndSwapInt64(&c.pausedAt, 0, time.Now().UnixNano())
 	} else {
 		atomic.StoreInt32(&c.paused, 0)
+		atomic.StoreInt64(&c.pausedAt, 0)
 	}
 
 	c.RLock()
@@ -304,22 +401,71 @@ func (c *Channel) PutMessage(m *Message) error {
 }
 
 func (c *Channel) put(m *Message) error {
+	if m.enqueuedAt == 0 {
+		m.enqueuedAt = time.Now().UnixNano()
+	}
+	m.deliverableAt = time.Now().UnixNano()
+	// added first (and taken back if it does not fit) so that a receiver
+	// never takes it below zero
+	atomic.AddInt64(&c.memoryBytes, messageSize(m))
 	select {
 	case c.memoryMsgChan <- m:
 	default:
+		atomic.AddInt64(&c.memoryBytes, -messageSize(m))
 		b := bufferPoolGet()
 		err := writeMessageToBackend(b, m, c.backend)
 		bufferPoolPut(b)
 		c.ctx.nsqd.SetHealth(err)
 		if err != nil {
+			c.lastError.set(err)
 			c.ctx.nsqd.logf(LOG_ERROR, "CHANNEL(%s): failed to write message to backend - %s",
 				c.name, err)
 			return err
 		}
 	}
+	c.updateEmptyState()
 	return nil
 }
 
+// updateEmptyState records when the channel's depth last went from zero to
+// non-zero (or back), it is called whenever a message enters or leaves the
+// queue so that stats can report how long it has been (non-)empty for
+func (c *Channel) updateEmptyState() {
+	var empty int32
+	if c.Depth() == 0 {
+		empty = 1
+	}
+	if atomic.LoadInt32(&c.isEmpty) == empty {
+		return
+	}
+
+	c.emptyStateMutex.Lock()
+	defer c.emptyStateMutex.Unlock()
+	// re-check under lock, we may have raced with another update
+	empty = 0
+	if c.Depth() == 0 {
+		empty = 1
+	}
+	if atomic.LoadInt32(&c.isEmpty) != empty {
+		atomic.StoreInt64(&c.emptyStateChangedAt, time.Now().UnixNano())
+		atomic.StoreInt32(&c.isEmpty, empty)
+	}
+}
+
+// emptyDurations returns how long (in seconds) the channel has been
+// continuously empty or non-empty, one of which is always zero
+func (c *Channel) emptyDurations() (int64, int64) {
+	c.updateEmptyState()
+
+	c.emptyStateMutex.Lock()
+	defer c.emptyStateMutex.Unlock()
+	d := int64(time.Since(time.Unix(0, atomic.LoadInt64(&c.emptyStateChangedAt))).Seconds())
+	if atomic.LoadInt32(&c.isEmpty) == 1 {
+		return d, 0
+	}
+	return 0, d
+}
+
 func (c *Channel) PutMessageDeferred(msg *Message, timeout time.Duration) {
 	atomic.AddUint64(&c.messageCount, 1)
 	c.StartDeferredTimeout(msg, timeout)
@@ -340,6 +486,9 @@ func (c *Channel) TouchMessage(clientID int64, id MessageID, clientMsgTimeout ti
 		newTimeout = msg.deliveryTS.Add(c.ctx.nsqd.getOpts().MaxMsgTimeout)
 	}
 
+	if extension := newTimeout.UnixNano() - msg.pri; extension > 0 {
+		atomic.AddInt64(&c.touchedNanos, extension)
+	}
 	msg.pri = newTimeout.UnixNano()
 	err = c.pushInFlightMessage(msg)
 	if err != nil {
@@ -351,15 +500,25 @@ func (c *Channel) TouchMessage(clientID int64, id MessageID, clientMsgTimeout ti
 
 // FinishMessage successfully discards an in-flight message
 func (c *Channel) FinishMessage(clientID int64, id MessageID) error {
+	_, err := c.finishMessage(clientID, id)
+	return err
+}
+
+// finishMessage is FinishMessage, also returning the finished message
+func (c *Channel) finishMessage(clientID int64, id MessageID) (*Message, error) {
 	msg, err := c.popInFlightMessage(clientID, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	c.removeFromInFlightPQ(msg)
 	if c.e2eProcessingLatencyStream != nil {
 		c.e2eProcessingLatencyStream.Insert(msg.Timestamp)
 	}
-	return nil
+	// messages read back from the backend have no enqueue time
+	if c.dwellTimeStream != nil && msg.enqueuedAt != 0 {
+		c.dwellTimeStream.Insert(msg.enqueuedAt)
+	}
+	return msg, nil
 }
 
 // RequeueMessage requeues a message based on `time.Duration`, ie:
@@ -402,6 +561,9 @@ func (c *Channel) AddClient(clientID int64, client Consumer) {
 		return
 	}
 	c.clients[clientID] = client
+	atomic.StoreInt32(&c.hadClient, 1)
+	c.clientCountHistory.update(len(c.clients)-1, len(c.clients),
+		c.ctx.nsqd.getOpts().ClientCountWindow, time.Now())
 }
 
 // RemoveClient removes a client from the Channel's client list
@@ -414,12 +576,27 @@ func (c *Channel) RemoveClient(clientID int64) {
 		return
 	}
 	delete(c.clients, clientID)
+	c.clientCountHistory.update(len(c.clients)+1, len(c.clients),
+		c.ctx.nsqd.getOpts().ClientCountWindow, time.Now())
 
 	if len(c.clients) == 0 && c.ephemeral == true {
 		go c.deleter.Do(func() { c.deleteCallback(c) })
 	}
 }
 
+// exceedsMaxAttempts returns true if the message has been attempted more than
+// --max-attempts times, in which case it is discarded rather than delivered
+func (c *Channel) exceedsMaxAttempts(msg *Message) bool {
+	maxAttempts := c.ctx.nsqd.getOpts().MaxAttempts
+	if maxAttempts <= 0 || int64(msg.Attempts) <= maxAttempts {
+		return false
+	}
+	atomic.AddUint64(&c.maxAttemptsExceededCount, 1)
+	c.ctx.nsqd.logf(LOG_WARN, "CHANNEL(%s): discarding message %s after %d attempts",
+		c.name, msg.ID, msg.Attempts-1)
+	return true
+}
+
 func (c *Channel) StartInFlightTimeout(msg *Message, clientID int64, timeout time.Duration) error {
 	now := time.Now()
 	msg.clientID = clientID
@@ -430,10 +607,42 @@ func (c *Channel) StartInFlightTimeout(msg *Message, clientID int64, timeout tim
 		return err
 	}
 	c.addToInFlightPQ(msg)
+	c.recordDeliveryOrder(msg.ID)
+	// messages read back from the backend have no deliverable time
+	if c.dispatchLatencyStream != nil && msg.deliverableAt != 0 {
+		c.dispatchLatencyStream.Insert(msg.deliverableAt)
+	}
+	c.updateEmptyState()
 	return nil
 }
 
+// recordDeliveryOrder counts the delivery of id as out of order when a message
+// with a later ID has already been delivered (eg. id was requeued, deferred or
+// read back from the backend). guids only increase per topic so this is an
+// approximation, concurrent deliveries to different clients race.
+func (c *Channel) recordDeliveryOrder(id MessageID) {
+	var b [8]byte
+	_, err := hex.Decode(b[:], id[:])
+	if err != nil {
+		return
+	}
+	v := binary.BigEndian.Uint64(b[:])
+	for {
+		max := atomic.LoadUint64(&c.maxDeliveredID)
+		if v < max {
+			atomic.AddUint64(&c.outOfOrderDeliveryCount, 1)
+			return
+		}
+		if v == max || atomic.CompareAndSwapUint64(&c.maxDeliveredID, max, v) {
+			return
+		}
+	}
+}
+
 func (c *Channel) StartDeferredTimeout(msg *Message, timeout time.Duration) error {
+	if msg.enqueuedAt == 0 {
+		msg.enqueuedAt = time.Now().UnixNano()
+	}
 	absTs := time.Now().Add(timeout).UnixNano()
 	item := &pqueue.Item{Value: msg, Priority: absTs}
 	err := c.pushDeferredMessage(item)
@@ -454,6 +663,9 @@ func (c *Channel) pushInFlightMessage(msg *Message) error {
 	}
 	c.inFlightMessages[msg.ID] = msg
 	atomic.StoreUint64(&c.inFlightCount, uint64(len(c.inFlightMessages)))
+	if msg.Attempts > 1 {
+		atomic.AddInt64(&c.retriedInFlightCount, 1)
+	}
 	c.inFlightMutex.Unlock()
 	return nil
 }
@@ -472,10 +684,142 @@ func (c *Channel) popInFlightMessage(clientID int64, id MessageID) (*Message, er
 	}
 	delete(c.inFlightMessages, id)
 	atomic.StoreUint64(&c.inFlightCount, uint64(len(c.inFlightMessages)))
+	if msg.Attempts > 1 {
+		atomic.AddInt64(&c.retriedInFlightCount, -1)
+	}
 	c.inFlightMutex.Unlock()
 	return msg, nil
 }
 
+// inFlightSnapshot is what NewChannelStats reports about the in-flight
+// messages, see inFlightStats
+type inFlightSnapshot struct {
+	// past their timeout but not (yet) requeued by queueScanLoop, in total and
+	// by client ID
+	overdue         int64
+	overdueByClient map[int64]int
+	// in-flight for more than 3/4 of their timeout, by client ID
+	nearTimeout map[int64]int64
+	// publish time (in ns) of the oldest in-flight message
+	oldestTimestamp int64
+	// of clients that are no longer subscribed. Messages of a client that
+	// disconnects are not requeued until they time out, so this is only
+	// non-zero for up to the msg timeout after a disconnect unless something
+	// has leaked.
+	leaked int64
+	// sent to a still subscribed client and within their timeout, ie. those
+	// awaiting a FIN/REQ/TOUCH rather than just not requeued yet
+	processing int64
+}
+
+// inFlightStats gathers an inFlightSnapshot as of now. It is a single pass over
+// the in-flight messages under one inFlightMutex acquisition, which blocks
+// FIN/REQ/TOUCH and processInFlightQueue, so anything that only needs a total
+// should be a counter kept at push/pop time (or come from inFlightPQ) rather
+// than another pass.
+func (c *Channel) inFlightStats(now time.Time) inFlightSnapshot {
+	s := inFlightSnapshot{
+		overdueByClient: make(map[int64]int),
+		nearTimeout:     make(map[int64]int64),
+	}
+	nowNano := now.UnixNano()
+	// the subscribed clients are taken first so that the channel lock is not
+	// held (nested) during the pass
+	c.RLock()
+	clientIDs := make(map[int64]struct{}, len(c.clients))
+	for id := range c.clients {
+		clientIDs[id] = struct{}{}
+	}
+	c.RUnlock()
+	c.inFlightMutex.Lock()
+	s.overdue = int64(c.inFlightPQ.CountBefore(nowNano))
+	for _, msg := range c.inFlightMessages {
+		if msg.pri <= nowNano {
+			s.overdueByClient[msg.clientID]++
+		}
+		delivered := msg.deliveryTS.UnixNano()
+		if nowNano-delivered > (msg.pri-delivered)*3/4 {
+			s.nearTimeout[msg.clientID]++
+		}
+		if s.oldestTimestamp == 0 || msg.Timestamp < s.oldestTimestamp {
+			s.oldestTimestamp = msg.Timestamp
+		}
+		if _, ok := clientIDs[msg.clientID]; !ok {
+			s.leaked++
+		} else if msg.pri > nowNano {
+			s.processing++
+		}
+	}
+	c.inFlightMutex.Unlock()
+	return s
+}
+
+// oldestAge returns how long ago (in ns) the oldest in-flight message was
+// published, zero when nothing is in-flight
+func (s inFlightSnapshot) oldestAge(now time.Time) int64 {
+	if s.oldestTimestamp == 0 {
+		return 0
+	}
+	return now.UnixNano() - s.oldestTimestamp
+}
+
+// sampleDepth caches the current depths for approximate stats, folds the depth
+// into the moving average and samples the timeout count for its trend. It is
+// only called from depthSampleLoop.
+func (c *Channel) sampleDepth(alpha float64) {
+	backendDepth := c.backend.Depth()
+	depth := int64(len(c.memoryMsgChan)) + backendDepth
+	atomic.StoreInt64(&c.sampledDepth, depth)
+	atomic.StoreInt64(&c.sampledBackendDepth, backendDepth)
+	c.updateDepthEWMA(float64(depth), alpha)
+	atomic.AddInt64(&c.depthSampleSum, depth)
+	atomic.AddInt64(&c.depthSampleCount, 1)
+	c.timeoutTrend.add(atomic.LoadUint64(&c.timeoutCount))
+}
+
+// timeWeightedAvgDepth is the average depth since the channel was created
+// (zero before the first sample)
+func (c *Channel) timeWeightedAvgDepth() float64 {
+	count := atomic.LoadInt64(&c.depthSampleCount)
+	if count == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&c.depthSampleSum)) / float64(count)
+}
+
+// depths returns the total and backend depth, either exactly or as of the last
+// sampleDepth (at most depthSampleInterval old, zero before the first sample)
+func (c *Channel) depths(approximate bool) (int64, int64) {
+	if approximate {
+		return atomic.LoadInt64(&c.sampledDepth), atomic.LoadInt64(&c.sampledBackendDepth)
+	}
+	backendDepth := c.backend.Depth()
+	return int64(len(c.memoryMsgChan)) + backendDepth, backendDepth
+}
+
+// updateDepthEWMA folds depth into the depth moving average, the first sample
+// seeds it (so a channel that starts with a backlog does not look like it is
+// growing)
+func (c *Channel) updateDepthEWMA(depth float64, alpha float64) {
+	if atomic.CompareAndSwapInt32(&c.depthEWMAInit, 0, 1) {
+		atomic.StoreUint64(&c.depthEWMA, math.Float64bits(depth))
+		return
+	}
+	ewma := math.Float64frombits(atomic.LoadUint64(&c.depthEWMA))
+	ewma += alpha * (depth - ewma)
+	atomic.StoreUint64(&c.depthEWMA, math.Float64bits(ewma))
+}
+
+// deferredTimerCount returns the number of entries in the deferred priority
+// queue, it can briefly differ from deferredCount while a message is being
+// added or popped
+func (c *Channel) deferredTimerCount() int {
+	c.deferredMutex.Lock()
+	n := len(c.deferredPQ)
+	c.deferredMutex.Unlock()
+	return n
+}
+
 func (c *Channel) addToInFlightPQ(msg *Message) {
 	c.inFlightMutex.Lock()
 	c.inFlightPQ.Push(msg)
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -127,6 +128,8 @@ func TestChannelEmpty(t *testing.T) {
 	test.Equal(t, 24, len(channel.inFlightPQ))
 	test.Equal(t, 1, len(channel.deferredMessages))
 	test.Equal(t, 1, len(channel.deferredPQ))
+	test.Equal(t, 1, channel.deferredTimerCount())
+	channel.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
 
 	channel.Empty()
 
@@ -134,7 +137,351 @@ func TestChannelEmpty(t *testing.T) {
 	test.Equal(t, 0, len(channel.inFlightPQ))
 	test.Equal(t, 0, len(channel.deferredMessages))
 	test.Equal(t, 0, len(channel.deferredPQ))
+	test.Equal(t, 0, channel.deferredTimerCount())
 	test.Equal(t, int64(0), channel.Depth())
+	test.Equal(t, uint64(26), atomic.LoadUint64(&channel.emptiedMessageCount))
+}
+
+func TestChannelTouchedMessageSeconds(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_channel_touched_message_seconds" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("channel")
+
+	msg := NewMessage(topic.GenerateID(), []byte("test"))
+	channel.StartInFlightTimeout(msg, 0, 0)
+	err := channel.TouchMessage(0, msg.ID, 10*time.Second)
+	test.Nil(t, err)
+	test.Equal(t, int64(10), NewChannelStats(channel, nil, false).TouchedMessageSeconds)
+
+	// a TOUCH that shortens the timeout does not count
+	err = channel.TouchMessage(0, msg.ID, time.Second)
+	test.Nil(t, err)
+	test.Equal(t, int64(10), NewChannelStats(channel, nil, false).TouchedMessageSeconds)
+}
+
+func TestChannelMsgTimeoutStats(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.MsgTimeout = 30 * time.Second
+	opts.MaxMsgTimeout = 5 * time.Minute
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	stats := NewChannelStats(nsqd.GetTopic("test").GetChannel("ch"), nil, false)
+	test.Equal(t, int64(30000), stats.MsgTimeout)
+	test.Equal(t, int64(300000), stats.MaxMsgTimeout)
+}
+
+func TestChannelRetriedInFlightCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_channel_retried_in_flight_count" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("channel")
+
+	var msgs []*Message
+	for i := uint16(1); i <= 3; i++ {
+		msg := NewMessage(topic.GenerateID(), []byte("test"))
+		msg.Attempts = i
+		channel.StartInFlightTimeout(msg, 0, opts.MsgTimeout)
+		msgs = append(msgs, msg)
+	}
+	test.Equal(t, int64(2), NewChannelStats(channel, nil, false).RetriedInFlightCount)
+
+	channel.FinishMessage(0, msgs[0].ID)
+	channel.FinishMessage(0, msgs[2].ID)
+	test.Equal(t, int64(1), NewChannelStats(channel, nil, false).RetriedInFlightCount)
+
+	channel.Empty()
+	test.Equal(t, int64(0), NewChannelStats(channel, nil, false).RetriedInFlightCount)
+}
+
+func TestChannelOutOfOrderDeliveryCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_channel_out_of_order_delivery_count" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("channel")
+
+	first := NewMessage(topic.GenerateID(), []byte("test"))
+	second := NewMessage(topic.GenerateID(), []byte("test"))
+	channel.StartInFlightTimeout(first, 0, opts.MsgTimeout)
+	channel.StartInFlightTimeout(second, 0, opts.MsgTimeout)
+	test.Equal(t, uint64(0), NewChannelStats(channel, nil, false).OutOfOrderDeliveryCount)
+
+	// first is redelivered after second
+	channel.RequeueMessage(0, first.ID, 0)
+	msg := <-channel.memoryMsgChan
+	channel.StartInFlightTimeout(msg, 0, opts.MsgTimeout)
+	test.Equal(t, uint64(1), NewChannelStats(channel, nil, false).OutOfOrderDeliveryCount)
+}
+
+func TestChannelOverdueInFlightCounts(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_channel_overdue_in_flight_counts" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("channel")
+
+	// client 1 has two messages due in a second, client 2 one due in an hour
+	for _, clientID := range []int64{1, 1, 2} {
+		timeout := time.Second
+		if clientID == 2 {
+			timeout = time.Hour
+		}
+		msg := NewMessage(topic.GenerateID(), []byte("test"))
+		channel.StartInFlightTimeout(msg, clientID, timeout)
+	}
+
+	test.Equal(t, 0, len(channel.inFlightStats(time.Now()).overdueByClient))
+	counts := channel.inFlightStats(time.Now().Add(time.Minute)).overdueByClient
+	test.Equal(t, 2, counts[1])
+	test.Equal(t, 0, counts[2])
+}
+
+func TestChannelLeakedInFlightCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_channel_leaked_in_flight_count" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("channel")
+	client := newClientV2(1, nil, &context{nsqd})
+	channel.AddClient(client.ID, client)
+
+	for _, clientID := range []int64{1, 2} {
+		msg := NewMessage(topic.GenerateID(), []byte("test"))
+		channel.StartInFlightTimeout(msg, clientID, opts.MsgTimeout)
+	}
+	test.Equal(t, int64(1), NewChannelStats(channel, nil, false).LeakedInFlightCount)
+
+	channel.RemoveClient(client.ID)
+	test.Equal(t, int64(2), NewChannelStats(channel, nil, false).LeakedInFlightCount)
+}
+
+func TestChannelProcessingCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_channel_processing_count" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("channel")
+	client := newClientV2(1, nil, &context{nsqd})
+	channel.AddClient(client.ID, client)
+	defer channel.RemoveClient(client.ID)
+
+	// one being processed, one overdue (not yet requeued by the queue scan)
+	// and one of a client that has gone
+	channel.StartInFlightTimeout(NewMessage(topic.GenerateID(), []byte("test")), 1, opts.MsgTimeout)
+	channel.StartInFlightTimeout(NewMessage(topic.GenerateID(), []byte("test")), 1, -time.Second)
+	channel.StartInFlightTimeout(NewMessage(topic.GenerateID(), []byte("test")), 2, opts.MsgTimeout)
+
+	stats := NewChannelStats(channel, nil, false)
+	test.Equal(t, uint64(3), stats.InFlightCount)
+	test.Equal(t, int64(1), stats.ProcessingCount)
+}
+
+func TestChannelDwellTime(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.E2EProcessingLatencyPercentiles = []float64{1.0}
+	opts.DwellTimeEnabled = true
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topic := nsqd.GetTopic("test_channel_dwell_time")
+	// not added to the topic so that there is no consumer to race with
+	channel := NewChannel(topic.name, "ch", &context{nsqd}, func(*Channel) {})
+	defer channel.Close()
+
+	channel.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	msg := <-channel.memoryMsgChan
+	time.Sleep(10 * time.Millisecond)
+	channel.StartInFlightTimeout(msg, 0, opts.MsgTimeout)
+	err := channel.FinishMessage(0, msg.ID)
+	test.Nil(t, err)
+
+	dwellTime := NewChannelStats(channel, nil, false).DwellTime
+	test.Equal(t, 1, dwellTime.Count)
+	if dwellTime.Percentiles[0]["value"] < float64(10*time.Millisecond) {
+		t.Fatalf("dwell time %v less than time queued", dwellTime.Percentiles[0]["value"])
+	}
+}
+
+func TestChannelDispatchLatency(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.E2EProcessingLatencyPercentiles = []float64{1.0}
+	opts.DispatchLatencyEnabled = true
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topic := nsqd.GetTopic("test_channel_dispatch_latency")
+	// not added to the topic so that there is no consumer to race with
+	channel := NewChannel(topic.name, "ch", &context{nsqd}, func(*Channel) {})
+	defer channel.Close()
+
+	channel.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	msg := <-channel.memoryMsgChan
+	time.Sleep(10 * time.Millisecond)
+	channel.StartInFlightTimeout(msg, 0, opts.MsgTimeout)
+
+	dispatchLatency := NewChannelStats(channel, nil, false).DispatchLatency
+	test.Equal(t, 1, dispatchLatency.Count)
+	if dispatchLatency.Percentiles[0]["value"] < float64(10*time.Millisecond) {
+		t.Fatalf("dispatch latency %v less than time queued", dispatchLatency.Percentiles[0]["value"])
+	}
+
+	// a message read back from the backend is not counted
+	channel.StartInFlightTimeout(NewMessage(topic.GenerateID(), []byte("test")), 0, opts.MsgTimeout)
+	test.Equal(t, 1, NewChannelStats(channel, nil, false).DispatchLatency.Count)
+}
+
+func TestChannelHeldByPauseCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topic := nsqd.GetTopic("test_channel_held_by_pause_count")
+	channel := topic.GetChannel("channel")
+	channel.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	channel.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	channel.StartDeferredTimeout(NewMessage(topic.GenerateID(), []byte("test")), time.Minute)
+	test.Equal(t, int64(0), NewChannelStats(channel, nil, false).HeldByPauseCount)
+
+	channel.Pause()
+	test.Equal(t, int64(2), NewChannelStats(channel, nil, false).HeldByPauseCount)
+	channel.UnPause()
+	test.Equal(t, int64(0), NewChannelStats(channel, nil, false).HeldByPauseCount)
+}
+
+func TestChannelEmptyDurations(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_channel_empty_durations" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("channel")
+
+	channel.emptyStateChangedAt = time.Now().Add(-5 * time.Second).UnixNano()
+	timeEmpty, timeNonEmpty := channel.emptyDurations()
+	test.Equal(t, int64(5), timeEmpty)
+	test.Equal(t, int64(0), timeNonEmpty)
+
+	// becoming non-empty resets the clock
+	channel.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	timeEmpty, timeNonEmpty = channel.emptyDurations()
+	test.Equal(t, int64(0), timeEmpty)
+	test.Equal(t, int64(0), timeNonEmpty)
+
+	channel.emptyStateChangedAt = time.Now().Add(-3 * time.Second).UnixNano()
+	channel.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	timeEmpty, timeNonEmpty = channel.emptyDurations()
+	test.Equal(t, int64(0), timeEmpty)
+	test.Equal(t, int64(3), timeNonEmpty)
+
+	channel.Empty()
+	test.Equal(t, int32(1), channel.isEmpty)
+}
+
+func TestChannelDepthEWMA(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topic := nsqd.GetTopic("test_channel_depth_ewma")
+	// not added to the topic so that depthSampleLoop does not update it
+	channel := NewChannel(topic.name, "ch", &context{nsqd}, func(*Channel) {})
+	defer channel.Close()
+
+	for i := 0; i < 10; i++ {
+		channel.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	}
+	channel.sampleDepth(0.5)
+	test.Equal(t, float64(10), NewChannelStats(channel, nil, false).DepthEWMA)
+
+	channel.Empty()
+	channel.sampleDepth(0.5)
+	test.Equal(t, float64(5), NewChannelStats(channel, nil, false).DepthEWMA)
+	channel.sampleDepth(0.5)
+	test.Equal(t, 2.5, NewChannelStats(channel, nil, false).DepthEWMA)
+}
+
+func TestChannelTimeWeightedAvgDepth(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topic := nsqd.GetTopic("test_channel_time_weighted_avg_depth")
+	// not added to the topic so that depthSampleLoop does not update it
+	channel := NewChannel(topic.name, "ch", &context{nsqd}, func(*Channel) {})
+	defer channel.Close()
+
+	test.Equal(t, float64(0), NewChannelStats(channel, nil, false).TimeWeightedAvgDepth)
+	for i := 0; i < 9; i++ {
+		channel.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	}
+	channel.sampleDepth(0.5)
+	channel.Empty()
+	channel.sampleDepth(0.5)
+	channel.sampleDepth(0.5)
+	test.Equal(t, float64(3), NewChannelStats(channel, nil, false).TimeWeightedAvgDepth)
+}
+
+func TestChannelMemoryDepthBytes(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topic := nsqd.GetTopic("test_channel_memory_depth_bytes")
+	channel := NewChannel(topic.name, "ch", &context{nsqd}, func(*Channel) {})
+	defer channel.Close()
+
+	for i := 0; i < 2; i++ {
+		channel.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	}
+	test.Equal(t, int64(2*(minValidMsgLength+len("test"))), NewChannelStats(channel, nil, false).MemoryDepthBytes)
+
+	channel.Empty()
+	test.Equal(t, int64(0), NewChannelStats(channel, nil, false).MemoryDepthBytes)
 }
 
 func TestChannelEmptyConsumer(t *testing.T) {
@@ -164,6 +511,8 @@ func TestChannelEmptyConsumer(t *testing.T) {
 		stats := cl.Stats()
 		test.Equal(t, int64(25), stats.InFlightCount)
 	}
+	test.Equal(t, int64(25), nsqd.GetStats(topicName, "channel")[0].Channels[0].TotalRdyCount)
+	test.Equal(t, false, nsqd.GetStats(topicName, "channel")[0].Channels[0].AllClientsPaused)
 
 	channel.Empty()
 
@@ -171,6 +520,9 @@ func TestChannelEmptyConsumer(t *testing.T) {
 		stats := cl.Stats()
 		test.Equal(t, int64(0), stats.InFlightCount)
 	}
+
+	client.SetReadyCount(0)
+	test.Equal(t, true, nsqd.GetStats(topicName, "channel")[0].Channels[0].AllClientsPaused)
 }
 
 func TestChannelHealth(t *testing.T) {
@@ -0,0 +1,70 @@
+package nsqd
+
+import (
+	"sync"
+	"time"
+)
+
+// clientCountHistory tracks the min and max client count over a rolling
+// window, made up of two halves so that bounds age out smoothly (the oldest
+// half is discarded every window/2)
+type clientCountHistory struct {
+	sync.Mutex
+	halves       [2]clientCountBounds
+	currentIndex int
+	halfStart    time.Time
+}
+
+type clientCountBounds struct {
+	min int
+	max int
+}
+
+// update records a change of client count from prevCount to count
+func (h *clientCountHistory) update(prevCount int, count int, window time.Duration, now time.Time) {
+	h.Lock()
+	h.advance(prevCount, window, now)
+	b := &h.halves[h.currentIndex]
+	if count < b.min {
+		b.min = count
+	}
+	if count > b.max {
+		b.max = count
+	}
+	h.Unlock()
+}
+
+// bounds returns the min and max client count over (roughly) the last window,
+// count is the current client count
+func (h *clientCountHistory) bounds(count int, window time.Duration, now time.Time) (int, int) {
+	h.Lock()
+	defer h.Unlock()
+	h.advance(count, window, now)
+	min, max := count, count
+	for _, b := range h.halves {
+		if b.min < min {
+			min = b.min
+		}
+		if b.max > max {
+			max = b.max
+		}
+	}
+	return min, max
+}
+
+// advance moves on to a new half for each elapsed window/2, count is the
+// client count since the last update (ie. what each new half starts at)
+func (h *clientCountHistory) advance(count int, window time.Duration, now time.Time) {
+	halfWindow := window / 2
+	if h.halfStart.IsZero() || halfWindow <= 0 || now.Sub(h.halfStart) >= window {
+		h.halves[0] = clientCountBounds{count, count}
+		h.halves[1] = h.halves[0]
+		h.halfStart = now
+		return
+	}
+	for now.Sub(h.halfStart) >= halfWindow {
+		h.currentIndex = (h.currentIndex + 1) % len(h.halves)
+		h.halves[h.currentIndex] = clientCountBounds{count, count}
+		h.halfStart = h.halfStart.Add(halfWindow)
+	}
+}
@@ -0,0 +1,40 @@
+package nsqd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nsqio/nsq/internal/test"
+)
+
+func TestClientCountHistory(t *testing.T) {
+	var h clientCountHistory
+	window := time.Minute
+	start := time.Now()
+
+	min, max := h.bounds(0, window, start)
+	test.Equal(t, 0, min)
+	test.Equal(t, 0, max)
+
+	h.update(0, 1, window, start)
+	h.update(1, 2, window, start.Add(time.Second))
+	h.update(2, 1, window, start.Add(2*time.Second))
+	min, max = h.bounds(1, window, start.Add(3*time.Second))
+	test.Equal(t, 0, min)
+	test.Equal(t, 2, max)
+
+	// the first half ages out, the count it ended on carries over
+	min, max = h.bounds(1, window, start.Add(window+time.Second))
+	test.Equal(t, 1, min)
+	test.Equal(t, 1, max)
+
+	h.update(1, 3, window, start.Add(window+2*time.Second))
+	min, max = h.bounds(3, window, start.Add(window+3*time.Second))
+	test.Equal(t, 1, min)
+	test.Equal(t, 3, max)
+
+	// idle for longer than the window
+	min, max = h.bounds(3, window, start.Add(5*window))
+	test.Equal(t, 3, min)
+	test.Equal(t, 3, max)
+}
@@ -5,6 +5,7 @@ import (
 	"compress/flate"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -12,10 +13,16 @@ import (
 
 	"github.com/golang/snappy"
 	"github.com/nsqio/nsq/internal/auth"
+	"github.com/nsqio/nsq/internal/ewma"
+	"github.com/nsqio/nsq/internal/quantile"
 )
 
 const defaultBufferSize = 16 * 1024
 
+// maxLastCommandLength bounds the command name kept for stats, clients can
+// send arbitrary (invalid) command lines
+const maxLastCommandLength = 16
+
 const (
 	stateInit = iota
 	stateDisconnected
@@ -55,6 +62,26 @@ type clientV2 struct {
 	FinishCount   uint64
 	RequeueCount  uint64
 
+	// bytes written before and after deflate/snappy compression
+	uncompressedBytes uint64
+	compressedBytes   uint64
+
+	// time (in ns) of the most recently received command
+	lastCommandAt int64
+
+	// failed writes (or flushes) to the connection
+	writeErrorCount uint64
+
+	// time (in ns) the last heartbeat was sent and heartbeats that were not
+	// followed by any command before the next one
+	lastHeartbeatAt      int64
+	missedHeartbeatCount uint64
+
+	// messages (and bytes, before compression) written to Writer but not yet
+	// flushed, only updated under writeLock
+	bufferedMessageCount int64
+	bufferedBytes        int64
+
 	writeLock sync.RWMutex
 	metaLock  sync.RWMutex
 
@@ -104,6 +131,17 @@ type clientV2 struct {
 
 	AuthSecret string
 	AuthState  *auth.State
+
+	// smoothed messages/sec sent to this client
+	messageRate *ewma.Rate
+
+	// time from sending a message to its FIN, nil unless --ack-latency
+	ackLatencyStream *quantile.Quantile
+
+	lastCommand string
+
+	// whether the client has sent a RDY, only used by the IOLoop goroutine
+	readyCountSet bool
 }
 
 func newClientV2(id int64, conn net.Conn, ctx *context) *clientV2 {
@@ -141,6 +179,15 @@ func newClientV2(id int64, conn net.Conn, ctx *context) *clientV2 {
 
 		// heartbeats are client configurable but default to 30s
 		HeartbeatInterval: ctx.nsqd.getOpts().ClientTimeout / 2,
+
+		messageRate: ewma.NewRate(time.Minute),
+	}
+	opts := ctx.nsqd.getOpts()
+	if opts.AckLatencyEnabled && len(opts.E2EProcessingLatencyPercentiles) > 0 {
+		c.ackLatencyStream = quantile.New(
+			opts.E2EProcessingLatencyWindowTime,
+			opts.E2EProcessingLatencyPercentiles,
+		)
 	}
 	c.lenSlice = c.lenBuf[:]
 	return c
@@ -150,6 +197,17 @@ func (c *clientV2) String() string {
 	return c.RemoteAddr().String()
 }
 
+// version is what GetClientVersions counts c by, its UserAgent or (before or
+// without one) its protocol version
+func (c *clientV2) version() string {
+	c.metaLock.RLock()
+	defer c.metaLock.RUnlock()
+	if c.UserAgent != "" {
+		return c.UserAgent
+	}
+	return "V2"
+}
+
 func (c *clientV2) Identify(data identifyDataV2) error {
 	c.ctx.nsqd.logf(LOG_INFO, "[%s] IDENTIFY: %+v", c, data)
 
@@ -200,11 +258,38 @@ func (c *clientV2) Identify(data identifyDataV2) error {
 	return nil
 }
 
+// recordCommand remembers the name (and time) of the last command received
+func (c *clientV2) recordCommand(name []byte) {
+	if len(name) > maxLastCommandLength {
+		name = name[:maxLastCommandLength]
+	}
+	c.metaLock.Lock()
+	c.lastCommand = string(name)
+	c.metaLock.Unlock()
+	atomic.StoreInt64(&c.lastCommandAt, time.Now().UnixNano())
+}
+
+// recordHeartbeat is called (by messagePump) as each heartbeat is sent, the
+// previous one was missed if no command has been received since it was sent
+func (c *clientV2) recordHeartbeat(now time.Time) {
+	last := atomic.LoadInt64(&c.lastHeartbeatAt)
+	if last != 0 && atomic.LoadInt64(&c.lastCommandAt) < last {
+		atomic.AddUint64(&c.missedHeartbeatCount, 1)
+	}
+	atomic.StoreInt64(&c.lastHeartbeatAt, now.UnixNano())
+}
+
 func (c *clientV2) Stats() ClientStats {
 	c.metaLock.RLock()
 	clientID := c.ClientID
 	hostname := c.Hostname
 	userAgent := c.UserAgent
+	lastCommand := c.lastCommand
+	var topicName, channelName string
+	if c.Channel != nil {
+		topicName = c.Channel.topicName
+		channelName = c.Channel.name
+	}
 	var identity string
 	var identityURL string
 	if c.AuthState != nil {
@@ -218,10 +303,13 @@ func (c *clientV2) Stats() ClientStats {
 		ClientID:        clientID,
 		Hostname:        hostname,
 		UserAgent:       userAgent,
+		Topic:           topicName,
+		Channel:         channelName,
 		State:           atomic.LoadInt32(&c.State),
 		ReadyCount:      atomic.LoadInt64(&c.ReadyCount),
 		InFlightCount:   atomic.LoadInt64(&c.InFlightCount),
 		MessageCount:    atomic.LoadUint64(&c.MessageCount),
+		MessageRate:     c.messageRate.Rate(),
 		FinishCount:     atomic.LoadUint64(&c.FinishCount),
 		RequeueCount:    atomic.LoadUint64(&c.RequeueCount),
 		ConnectTime:     c.ConnectTime.Unix(),
@@ -232,6 +320,24 @@ func (c *clientV2) Stats() ClientStats {
 		Authed:          c.HasAuthorizations(),
 		AuthIdentity:    identity,
 		AuthIdentityURL: identityURL,
+
+		LastCommand:          lastCommand,
+		LastCommandTimestamp: atomic.LoadInt64(&c.lastCommandAt),
+
+		WriteErrorCount: atomic.LoadUint64(&c.writeErrorCount),
+
+		MissedHeartbeatCount: atomic.LoadUint64(&c.missedHeartbeatCount),
+
+		BufferedMessageCount: int(atomic.LoadInt64(&c.bufferedMessageCount)),
+		BufferedBytes:        int(atomic.LoadInt64(&c.bufferedBytes)),
+
+		id: c.ID,
+	}
+	if c.ackLatencyStream != nil {
+		stats.AckLatency = c.ackLatencyStream.Result()
+	}
+	if compressed := atomic.LoadUint64(&c.compressedBytes); compressed > 0 {
+		stats.CompressionRatio = float64(atomic.LoadUint64(&c.uncompressedBytes)) / float64(compressed)
 	}
 	if stats.TLS {
 		p := prettyConnectionState{c.tlsConn.ConnectionState()}
@@ -341,6 +447,7 @@ func (c *clientV2) Empty() {
 func (c *clientV2) SendingMessage() {
 	atomic.AddInt64(&c.InFlightCount, 1)
 	atomic.AddUint64(&c.MessageCount, 1)
+	c.messageRate.Update(1)
 }
 
 func (c *clientV2) TimedOutMessage() {
@@ -469,6 +576,7 @@ func (c *clientV2) UpgradeTLS() error {
 	tlsConn.SetDeadline(time.Now().Add(5 * time.Second))
 	err := tlsConn.Handshake()
 	if err != nil {
+		atomic.AddUint64(&c.ctx.nsqd.tlsHandshakeFailureCount, 1)
 		return err
 	}
 	c.tlsConn = tlsConn
@@ -492,9 +600,9 @@ func (c *clientV2) UpgradeDeflate(level int) error {
 
 	c.Reader = bufio.NewReaderSize(flate.NewReader(conn), defaultBufferSize)
 
-	fw, _ := flate.NewWriter(conn, level)
+	fw, _ := flate.NewWriter(byteCountingWriter{conn, &c.compressedBytes}, level)
 	c.flateWriter = fw
-	c.Writer = bufio.NewWriterSize(fw, c.OutputBufferSize)
+	c.Writer = bufio.NewWriterSize(byteCountingWriter{fw, &c.uncompressedBytes}, c.OutputBufferSize)
 
 	atomic.StoreInt32(&c.Deflate, 1)
 
@@ -511,7 +619,8 @@ func (c *clientV2) UpgradeSnappy() error {
 	}
 
 	c.Reader = bufio.NewReaderSize(snappy.NewReader(conn), defaultBufferSize)
-	c.Writer = bufio.NewWriterSize(snappy.NewWriter(conn), c.OutputBufferSize)
+	sw := snappy.NewWriter(byteCountingWriter{conn, &c.compressedBytes})
+	c.Writer = bufio.NewWriterSize(byteCountingWriter{sw, &c.uncompressedBytes}, c.OutputBufferSize)
 
 	atomic.StoreInt32(&c.Snappy, 1)
 
@@ -528,16 +637,39 @@ func (c *clientV2) Flush() error {
 
 	err := c.Writer.Flush()
 	if err != nil {
+		atomic.AddUint64(&c.writeErrorCount, 1)
 		return err
 	}
+	atomic.StoreInt64(&c.bufferedMessageCount, 0)
+	atomic.StoreInt64(&c.bufferedBytes, 0)
 
 	if c.flateWriter != nil {
-		return c.flateWriter.Flush()
+		err = c.flateWriter.Flush()
+		if err != nil {
+			atomic.AddUint64(&c.writeErrorCount, 1)
+		}
+		return err
 	}
 
 	return nil
 }
 
+// recordBuffered updates the buffered stats after a message frame of frameLen
+// bytes was written to Writer when it held prevBuffered bytes, a write that
+// overflows Writer flushes it leaving (at most) the tail of this frame
+func (c *clientV2) recordBuffered(prevBuffered int, frameLen int) {
+	buffered := c.Writer.Buffered()
+	count := atomic.LoadInt64(&c.bufferedMessageCount) + 1
+	if buffered < prevBuffered+frameLen {
+		count = 0
+		if buffered > 0 {
+			count = 1
+		}
+	}
+	atomic.StoreInt64(&c.bufferedMessageCount, count)
+	atomic.StoreInt64(&c.bufferedBytes, int64(buffered))
+}
+
 func (c *clientV2) QueryAuthd() error {
 	remoteIP, _, err := net.SplitHostPort(c.String())
 	if err != nil {
@@ -587,3 +719,15 @@ func (c *clientV2) HasAuthorizations() bool {
 	}
 	return false
 }
+
+// byteCountingWriter adds the number of bytes written through it to count
+type byteCountingWriter struct {
+	io.Writer
+	count *uint64
+}
+
+func (w byteCountingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	atomic.AddUint64(w.count, uint64(n))
+	return n, err
+}
@@ -0,0 +1,18 @@
+// +build linux darwin freebsd
+
+package nsqd
+
+import (
+	"syscall"
+)
+
+// diskFreeBytes returns the number of bytes available to unprivileged users on
+// the filesystem containing path
+func diskFreeBytes(path string) (int64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,11 @@
+// +build !linux,!darwin,!freebsd
+
+package nsqd
+
+import (
+	"errors"
+)
+
+func diskFreeBytes(path string) (int64, error) {
+	return 0, errors.New("not supported on this platform")
+}
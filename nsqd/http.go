@@ -3,8 +3,10 @@ package nsqd
 import (
 	"bufio"
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -15,12 +17,15 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/nsqio/nsq/internal/clusterinfo"
 	"github.com/nsqio/nsq/internal/http_api"
 	"github.com/nsqio/nsq/internal/lg"
 	"github.com/nsqio/nsq/internal/protocol"
+	"github.com/nsqio/nsq/internal/quantile"
 	"github.com/nsqio/nsq/internal/version"
 )
 
@@ -60,6 +65,16 @@ func newHTTPServer(ctx *context, tlsEnabled bool, tlsRequired bool) *httpServer
 	router.Handle("POST", "/pub", http_api.Decorate(s.doPUB, http_api.V1))
 	router.Handle("POST", "/mpub", http_api.Decorate(s.doMPUB, http_api.V1))
 	router.Handle("GET", "/stats", http_api.Decorate(s.doStats, log, http_api.V1))
+	router.Handle("GET", "/stats/mem", http_api.Decorate(s.doMemStats, log, http_api.V1))
+	router.Handle("GET", "/stats/topology", http_api.Decorate(s.doStatsTopology, log, http_api.V1))
+	router.Handle("GET", "/stats/profile", http_api.Decorate(s.doStatsProfile, log, http_api.V1))
+	router.Handle("GET", "/stats/alerts", http_api.Decorate(s.doStatsAlerts, log, http_api.V1))
+	router.Handle("GET", "/stats/csv", http_api.Decorate(s.doCSVStats, log, http_api.PlainText))
+	router.Handle("GET", "/stats/cluster", http_api.Decorate(s.doClusterStats, log, http_api.V1))
+	router.Handle("GET", "/stats/e2e_samples", http_api.Decorate(s.doE2eSamples, log, http_api.V1))
+	router.Handle("POST", "/stats/snapshot", http_api.Decorate(s.doStatsSnapshot, log, http_api.V1))
+	router.Handle("GET", "/stats/history", http_api.Decorate(s.doStatsHistory, log, http_api.V1))
+	router.Handle("GET", "/stats/delta", http_api.Decorate(s.doStatsDelta, log, http_api.V1))
 
 	// only v1
 	router.Handle("POST", "/topic/create", http_api.Decorate(s.doCreateTopic, log, http_api.V1))
@@ -67,11 +82,13 @@ func newHTTPServer(ctx *context, tlsEnabled bool, tlsRequired bool) *httpServer
 	router.Handle("POST", "/topic/empty", http_api.Decorate(s.doEmptyTopic, log, http_api.V1))
 	router.Handle("POST", "/topic/pause", http_api.Decorate(s.doPauseTopic, log, http_api.V1))
 	router.Handle("POST", "/topic/unpause", http_api.Decorate(s.doPauseTopic, log, http_api.V1))
+	router.Handle("POST", "/topic/e2e_window", http_api.Decorate(s.doTopicE2eWindow, log, http_api.V1))
 	router.Handle("POST", "/channel/create", http_api.Decorate(s.doCreateChannel, log, http_api.V1))
 	router.Handle("POST", "/channel/delete", http_api.Decorate(s.doDeleteChannel, log, http_api.V1))
 	router.Handle("POST", "/channel/empty", http_api.Decorate(s.doEmptyChannel, log, http_api.V1))
 	router.Handle("POST", "/channel/pause", http_api.Decorate(s.doPauseChannel, log, http_api.V1))
 	router.Handle("POST", "/channel/unpause", http_api.Decorate(s.doPauseChannel, log, http_api.V1))
+	router.Handle("POST", "/channel/e2e_reset", http_api.Decorate(s.doResetChannelE2e, log, http_api.V1))
 	router.Handle("GET", "/config/:opt", http_api.Decorate(s.doConfig, log, http_api.V1))
 	router.Handle("PUT", "/config/:opt", http_api.Decorate(s.doConfig, log, http_api.V1))
 
@@ -228,6 +245,7 @@ func (s *httpServer) doPUB(w http.ResponseWriter, req *http.Request, ps httprout
 	if err != nil {
 		return nil, http_api.Err{503, "EXITING"}
 	}
+	atomic.AddUint64(&topic.httpPublishCount, 1)
 
 	return "OK", nil
 }
@@ -306,6 +324,7 @@ func (s *httpServer) doMPUB(w http.ResponseWriter, req *http.Request, ps httprou
 	if err != nil {
 		return nil, http_api.Err{503, "EXITING"}
 	}
+	atomic.AddUint64(&topic.httpPublishCount, uint64(len(msgs)))
 
 	return "OK", nil
 }
@@ -399,6 +418,58 @@ func (s *httpServer) doPauseTopic(w http.ResponseWriter, req *http.Request, ps h
 	return nil, nil
 }
 
+// the smallest e2e processing latency sub-window (and so window) and the most
+// sub-windows doTopicE2eWindow accepts
+const (
+	minE2eSubWindowTime = time.Second
+	maxE2eSubWindows    = 60
+)
+
+func (s *httpServer) doTopicE2eWindow(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := http_api.NewReqParams(req)
+	if err != nil {
+		s.ctx.nsqd.logf(LOG_ERROR, "failed to parse request params - %s", err)
+		return nil, http_api.Err{400, "INVALID_REQUEST"}
+	}
+
+	topicName, err := reqParams.Get("topic")
+	if err != nil {
+		return nil, http_api.Err{400, "MISSING_ARG_TOPIC"}
+	}
+
+	topic, err := s.ctx.nsqd.GetExistingTopic(topicName)
+	if err != nil {
+		return nil, http_api.Err{404, "TOPIC_NOT_FOUND"}
+	}
+
+	if len(s.ctx.nsqd.getOpts().E2EProcessingLatencyPercentiles) == 0 {
+		return nil, http_api.Err{400, "E2E_PROCESSING_LATENCY_DISABLED"}
+	}
+
+	windowString, err := reqParams.Get("window")
+	if err != nil {
+		return nil, http_api.Err{400, "MISSING_ARG_WINDOW"}
+	}
+	windowTime, err := time.ParseDuration(windowString)
+	if err != nil || windowTime < minE2eSubWindowTime {
+		return nil, http_api.Err{400, "INVALID_WINDOW"}
+	}
+
+	subWindows := 2
+	if subWindowsString, _ := reqParams.Get("sub_windows"); subWindowsString != "" {
+		subWindows, err = strconv.Atoi(subWindowsString)
+		if err != nil || subWindows < 1 || subWindows > maxE2eSubWindows {
+			return nil, http_api.Err{400, "INVALID_SUB_WINDOWS"}
+		}
+	}
+	if windowTime/time.Duration(subWindows) < minE2eSubWindowTime {
+		return nil, http_api.Err{400, "INVALID_SUB_WINDOWS"}
+	}
+
+	topic.SetE2eProcessingLatencyWindow(windowTime, subWindows)
+	return nil, nil
+}
+
 func (s *httpServer) doCreateChannel(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	_, topic, channelName, err := s.getExistingTopicFromQuery(req)
 	if err != nil {
@@ -441,6 +512,27 @@ func (s *httpServer) doDeleteChannel(w http.ResponseWriter, req *http.Request, p
 	return nil, nil
 }
 
+// doResetChannelE2e discards the channel's e2e processing latency samples so
+// that its percentiles only reflect messages finished from now on
+func (s *httpServer) doResetChannelE2e(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	_, topic, channelName, err := s.getExistingTopicFromQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	channel, err := topic.GetExistingChannel(channelName)
+	if err != nil {
+		return nil, http_api.Err{404, "CHANNEL_NOT_FOUND"}
+	}
+
+	if channel.e2eProcessingLatencyStream == nil {
+		return nil, http_api.Err{400, "E2E_PROCESSING_LATENCY_DISABLED"}
+	}
+
+	channel.e2eProcessingLatencyStream.Reset()
+	return nil, nil
+}
+
 func (s *httpServer) doPauseChannel(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	_, topic, channelName, err := s.getExistingTopicFromQuery(req)
 	if err != nil {
@@ -477,15 +569,117 @@ func (s *httpServer) doStats(w http.ResponseWriter, req *http.Request, ps httpro
 		return nil, http_api.Err{400, "INVALID_REQUEST"}
 	}
 	formatString, _ := reqParams.Get("format")
-	topicName, _ := reqParams.Get("topic")
 	channelName, _ := reqParams.Get("channel")
 	jsonFormat := formatString == "json"
 
-	stats := s.ctx.nsqd.GetStats(topicName, channelName)
+	// multiple topics can be given as repeated and/or comma separated params
+	var topicNames []string
+	topicParams, _ := reqParams.GetAll("topic")
+	for _, p := range topicParams {
+		for _, name := range strings.Split(p, ",") {
+			if name != "" {
+				topicNames = append(topicNames, name)
+			}
+		}
+	}
+	var topicName string
+	if len(topicNames) == 1 {
+		topicName = topicNames[0]
+	}
+
+	// approximate depths are sampled once per depthSampleInterval (1s) rather
+	// than read from every backend
+	var approximate bool
+	switch depthMode, _ := reqParams.Get("depth"); depthMode {
+	case "", "exact":
+	case "approximate":
+		approximate = true
+	default:
+		return nil, http_api.Err{400, "INVALID_DEPTH"}
+	}
+
+	clientsSort, _ := reqParams.Get("clients_sort")
+	if _, ok := clientSortKeys[clientsSort]; clientsSort != "" && !ok {
+		return nil, http_api.Err{400, "INVALID_CLIENTS_SORT"}
+	}
+	var clientsLimit int
+	if limitString, _ := reqParams.Get("clients_limit"); limitString != "" {
+		clientsLimit, err = strconv.Atoi(limitString)
+		if err != nil || clientsLimit < 0 {
+			return nil, http_api.Err{400, "INVALID_CLIENTS_LIMIT"}
+		}
+	}
+
+	// a map of every client, which can be large for widely consumed channels
+	var clientMessageCounts bool
+	if countsString, _ := reqParams.Get("client_message_counts"); countsString != "" {
+		var ok bool
+		clientMessageCounts, ok = boolParams[countsString]
+		if !ok {
+			return nil, http_api.Err{400, "INVALID_CLIENT_MESSAGE_COUNTS"}
+		}
+	}
+
+	var encodeNames bool
+	if encodeNamesString, _ := reqParams.Get("encode_names"); encodeNamesString != "" {
+		var ok bool
+		encodeNames, ok = boolParams[encodeNamesString]
+		if !ok {
+			return nil, http_api.Err{400, "INVALID_ENCODE_NAMES"}
+		}
+	}
+
+	var fields []string
+	fieldsString, _ := reqParams.Get("fields")
+	if fieldsString != "" {
+		for _, f := range strings.Split(fieldsString, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				fields = append(fields, f)
+			}
+		}
+	}
+
 	health := s.ctx.nsqd.GetHealth()
+
+	// the ETag only covers what writeStatsChecksum aggregates (plus health and
+	// the query), a 304 means message flow and topology have not changed, not
+	// that e.g. memory stats or uptime are the same
+	h := fnv.New64a()
+	io.WriteString(h, req.URL.RawQuery)
+	io.WriteString(h, health)
+	s.ctx.nsqd.writeStatsChecksum(h)
+	etag := fmt.Sprintf(`"%x"`, h.Sum64())
+	w.Header().Set("ETag", etag)
+	if req.Header.Get("If-None-Match") == etag {
+		return nil, http_api.Err{304, "NOT_MODIFIED"}
+	}
+
+	var stats []TopicStats
+	collectionStart := time.Now()
+	if len(topicNames) > 1 {
+		stats = s.ctx.nsqd.GetStatsForTopics(topicNames, channelName, approximate)
+	} else if approximate {
+		stats = s.ctx.nsqd.GetApproximateStats(topicName, channelName)
+	} else {
+		stats = s.ctx.nsqd.GetStats(topicName, channelName)
+	}
+	collectionDuration := time.Since(collectionStart)
 	startTime := s.ctx.nsqd.GetStartTime()
 	uptime := time.Since(startTime)
 
+	if clientMessageCounts {
+		setClientMessageCounts(stats)
+	}
+	sortAndLimitClients(stats, clientsSort, clientsLimit)
+
+	if digits := s.ctx.nsqd.getOpts().StatsQuantileDigits; digits > 0 {
+		roundStatsQuantiles(stats, digits)
+	}
+
+	if encodeNames {
+		encodeStatsNames(stats)
+	}
+
 	// If we WERE given a topic-name, remove stats for all the other topics:
 	if len(topicName) > 0 {
 		// Find the desired-topic-index:
@@ -514,14 +708,313 @@ func (s *httpServer) doStats(w http.ResponseWriter, req *http.Request, ps httpro
 	if !jsonFormat {
 		return s.printStats(stats, ms, health, startTime, uptime), nil
 	}
+	degraded, degradedReasons := s.ctx.nsqd.GetDegraded()
+
+	var topics interface{} = stats
+	if fieldsString != "" {
+		filtered, unknown, err := filterStatsFields(stats, fields)
+		if err != nil {
+			s.ctx.nsqd.logf(LOG_ERROR, "failed to filter stats fields - %s", err)
+			return nil, http_api.Err{500, "INTERNAL_ERROR"}
+		}
+		if len(unknown) > 0 {
+			w.Header().Set("Warning",
+				fmt.Sprintf(`299 nsqd "unknown fields: %s"`, strings.Join(unknown, ",")))
+		}
+		topics = filtered
+	}
+
+	persistDuration, persistAge := s.ctx.nsqd.GetMetadataPersistStats()
+	return struct {
+		Version     string      `json:"version"`
+		Health      string      `json:"health"`
+		StartTime   int64       `json:"start_time"`
+		Topics      interface{} `json:"topics"`
+		Memory      memStats    `json:"memory"`
+		ClientCount int         `json:"client_count"`
+
+		CollectionDurationUsec int64 `json:"collection_duration_usec"`
+
+		Degraded        bool     `json:"degraded"`
+		DegradedReasons []string `json:"degraded_reasons,omitempty"`
+
+		Lookupd []LookupdStats `json:"lookupd"`
+
+		TotalBackendBytes int64 `json:"total_backend_bytes"`
 
+		OrphanChannelCount int `json:"orphan_channel_count"`
+
+		LastMetadataPersistDuration int64 `json:"last_metadata_persist_duration"`
+		LastMetadataPersistAge      int64 `json:"last_metadata_persist_age"`
+
+		TLSHandshakeFailureCount           uint64 `json:"tls_handshake_failure_count"`
+		CompressionNegotiationFailureCount uint64 `json:"compression_negotiation_failure_count"`
+
+		BlockedSubCount  int `json:"blocked_sub_count"`
+		ClientGoroutines int `json:"client_goroutines"`
+
+		ClientVersions map[string]int `json:"client_versions"`
+
+		GUIDErrorCount uint64 `json:"guid_error_count"`
+
+		MaxRdyCount int64 `json:"max_rdy_count"`
+
+		AcceptedConnectionCount uint64 `json:"accepted_connection_count"`
+
+		Draining bool `json:"draining"`
+	}{version.Binary, health, startTime.Unix(), topics, ms,
+		s.ctx.nsqd.GetClientCount(),
+		int64(collectionDuration / time.Microsecond), degraded, degradedReasons,
+		s.ctx.nsqd.GetLookupdStats(), s.ctx.nsqd.GetTotalBackendBytes(),
+		s.ctx.nsqd.GetOrphanChannelCount(), persistDuration, persistAge,
+		s.ctx.nsqd.GetTLSHandshakeFailureCount(),
+		s.ctx.nsqd.GetCompressionNegotiationFailureCount(),
+		s.ctx.nsqd.GetBlockedSubCount(), s.ctx.nsqd.GetClientGoroutines(),
+		s.ctx.nsqd.GetClientVersions(), s.ctx.nsqd.GetGUIDErrorCount(),
+		s.ctx.nsqd.getOpts().MaxRdyCount, s.ctx.nsqd.GetAcceptedConnectionCount(),
+		s.ctx.nsqd.IsDraining()}, nil
+}
+
+// doMemStats returns only the node-level memory stats, it skips the topic
+// fan-out (and all topic/channel locking) so it is cheap to poll
+func (s *httpServer) doMemStats(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return getMemStats(), nil
+}
+
+// doStatsTopology returns only the topic and channel names, for comparing
+// what exists across nodes without the cost of the full stats
+func (s *httpServer) doStatsTopology(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	return struct {
-		Version   string       `json:"version"`
-		Health    string       `json:"health"`
-		StartTime int64        `json:"start_time"`
-		Topics    []TopicStats `json:"topics"`
-		Memory    memStats     `json:"memory"`
-	}{version.Binary, health, startTime.Unix(), stats, ms}, nil
+		Topics []TopologyTopic `json:"topics"`
+	}{s.ctx.nsqd.GetTopology()}, nil
+}
+
+// doStatsProfile returns how long each phase of the most recent stats
+// collection took, see StatsProfile
+func (s *httpServer) doStatsProfile(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return s.ctx.nsqd.GetStatsProfile(), nil
+}
+
+// doStatsAlerts returns only the topics and channels over an
+// --alert-*-threshold, see statsAlerts
+func (s *httpServer) doStatsAlerts(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	opts := s.ctx.nsqd.getOpts()
+	if !alertsEnabled(opts) {
+		return nil, http_api.Err{404, "ALERTS_DISABLED"}
+	}
+	return struct {
+		Alerts []StatsAlert `json:"alerts"`
+	}{statsAlerts(s.ctx.nsqd.GetStats("", ""), opts)}, nil
+}
+
+// doClusterStats returns the topic and channel stats of every
+// --stats-cluster-node merged together (optionally filtered by topic and
+// channel, like /stats)
+func (s *httpServer) doClusterStats(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := http_api.NewReqParams(req)
+	if err != nil {
+		s.ctx.nsqd.logf(LOG_ERROR, "failed to parse request params - %s", err)
+		return nil, http_api.Err{400, "INVALID_REQUEST"}
+	}
+	topicName, _ := reqParams.Get("topic")
+	channelName, _ := reqParams.Get("channel")
+
+	if len(s.ctx.nsqd.getOpts().StatsClusterNodes) == 0 {
+		return nil, http_api.Err{404, "STATS_CLUSTER_NOT_CONFIGURED"}
+	}
+
+	var message string
+	topics, err := s.ctx.nsqd.GetClusterStats(topicName, channelName)
+	if err != nil {
+		pe, ok := err.(clusterinfo.PartialErr)
+		if !ok {
+			s.ctx.nsqd.logf(LOG_ERROR, "failed to get cluster stats - %s", err)
+			return nil, http_api.Err{502, fmt.Sprintf("UPSTREAM_ERROR: %s", err)}
+		}
+		s.ctx.nsqd.logf(LOG_WARN, "%s", err)
+		message = pe.Error()
+	}
+
+	return struct {
+		Topics  []*clusterinfo.TopicStats `json:"topics"`
+		Message string                    `json:"message,omitempty"`
+	}{topics, message}, nil
+}
+
+func (s *httpServer) doStatsSnapshot(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	fileName, err := s.ctx.nsqd.WriteStatsSnapshot()
+	if err != nil {
+		s.ctx.nsqd.logf(LOG_ERROR, "failed to write stats snapshot - %s", err)
+		return nil, http_api.Err{500, "INTERNAL_ERROR"}
+	}
+	return struct {
+		Path string `json:"path"`
+	}{fileName}, nil
+}
+
+// maxE2eSamples caps the number of samples returned by /stats/e2e_samples
+const maxE2eSamples = 10000
+
+// doE2eSamples returns the e2e processing latency samples (in ns) currently
+// held for a channel, ie. those within the e2e processing latency window
+func (s *httpServer) doE2eSamples(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, topic, channelName, err := s.getExistingTopicFromQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	channel, err := topic.GetExistingChannel(channelName)
+	if err != nil {
+		return nil, http_api.Err{404, "CHANNEL_NOT_FOUND"}
+	}
+
+	limit := maxE2eSamples
+	if limitString, _ := reqParams.Get("limit"); limitString != "" {
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 0 {
+			return nil, http_api.Err{400, "INVALID_LIMIT"}
+		}
+		if limit > maxE2eSamples {
+			limit = maxE2eSamples
+		}
+	}
+
+	samples, count := channel.e2eProcessingLatencyStream.Samples(limit)
+	return struct {
+		Count     int               `json:"count"`
+		Truncated bool              `json:"truncated"`
+		Samples   []quantile.Sample `json:"samples"`
+	}{count, len(samples) < count, samples}, nil
+}
+
+// doStatsHistory returns (up to) the last n points kept by statsHistoryLoop,
+// oldest first, optionally filtered by topic and channel (like /stats)
+func (s *httpServer) doStatsHistory(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := http_api.NewReqParams(req)
+	if err != nil {
+		s.ctx.nsqd.logf(LOG_ERROR, "failed to parse request params - %s", err)
+		return nil, http_api.Err{400, "INVALID_REQUEST"}
+	}
+	topicName, _ := reqParams.Get("topic")
+	channelName, _ := reqParams.Get("channel")
+
+	if s.ctx.nsqd.statsHistory == nil {
+		return nil, http_api.Err{404, "STATS_HISTORY_DISABLED"}
+	}
+
+	n := s.ctx.nsqd.getOpts().StatsHistorySize
+	if nString, _ := reqParams.Get("n"); nString != "" {
+		n, err = strconv.Atoi(nString)
+		if err != nil || n < 0 {
+			return nil, http_api.Err{400, "INVALID_N"}
+		}
+	}
+
+	points := s.ctx.nsqd.statsHistory.last(n)
+	for i, p := range points {
+		points[i] = p.filter(topicName, channelName)
+	}
+	return struct {
+		IntervalMs int64               `json:"interval_ms"`
+		Points     []StatsHistoryPoint `json:"points"`
+	}{int64(s.ctx.nsqd.getOpts().StatsHistoryInterval / time.Millisecond), points}, nil
+}
+
+// doStatsDelta returns the numeric topic and channel stats (optionally
+// filtered by topic and channel, like /stats) that changed since the response
+// the given token came from, along with a new token. Without a token (or with
+// one that has expired or was for a different topic/channel) the response is
+// a reset holding every value, see statsDeltaTTL and maxStatsDeltas for how
+// long tokens are kept.
+func (s *httpServer) doStatsDelta(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := http_api.NewReqParams(req)
+	if err != nil {
+		s.ctx.nsqd.logf(LOG_ERROR, "failed to parse request params - %s", err)
+		return nil, http_api.Err{400, "INVALID_REQUEST"}
+	}
+	topicName, _ := reqParams.Get("topic")
+	channelName, _ := reqParams.Get("channel")
+	token, _ := reqParams.Get("token")
+
+	values, err := newStatsValues(s.ctx.nsqd.GetStats(topicName, channelName))
+	if err != nil {
+		s.ctx.nsqd.logf(LOG_ERROR, "failed to collect stats values - %s", err)
+		return nil, http_api.Err{500, "INTERNAL_ERROR"}
+	}
+	return s.ctx.nsqd.statsDeltas.delta(token, topicName+":"+channelName, values, time.Now()), nil
+}
+
+// doCSVStats returns one row per channel (optionally filtered by topic and
+// channel, like /stats) with a header row and a fixed column order
+func (s *httpServer) doCSVStats(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := http_api.NewReqParams(req)
+	if err != nil {
+		s.ctx.nsqd.logf(LOG_ERROR, "failed to parse request params - %s", err)
+		return nil, http_api.Err{400, "INVALID_REQUEST"}
+	}
+	topicName, _ := reqParams.Get("topic")
+	channelName, _ := reqParams.Get("channel")
+
+	stats := s.ctx.nsqd.GetStats(topicName, channelName)
+	data, err := csvStats(stats, s.ctx.nsqd.getOpts().E2EProcessingLatencyPercentiles)
+	if err != nil {
+		s.ctx.nsqd.logf(LOG_ERROR, "failed to write CSV stats - %s", err)
+		return nil, http_api.Err{500, "INTERNAL_ERROR"}
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	return data, nil
+}
+
+func csvStats(stats []TopicStats, percentiles []float64) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	header := []string{"topic", "channel", "depth", "backend_depth", "in_flight_count",
+		"deferred_count", "message_count", "requeue_count", "timeout_count", "client_count",
+		"paused", "e2e_processing_latency_count"}
+	for _, p := range percentiles {
+		header = append(header,
+			fmt.Sprintf("e2e_processing_latency_p%s", strconv.FormatFloat(p*100, 'f', -1, 64)))
+	}
+	w.Write(header)
+
+	for _, t := range stats {
+		for _, c := range t.Channels {
+			record := []string{
+				t.TopicName,
+				c.ChannelName,
+				strconv.FormatInt(c.Depth, 10),
+				strconv.FormatInt(c.BackendDepth, 10),
+				strconv.FormatUint(c.InFlightCount, 10),
+				strconv.FormatUint(c.DeferredCount, 10),
+				strconv.FormatUint(c.MessageCount, 10),
+				strconv.FormatUint(c.RequeueCount, 10),
+				strconv.FormatUint(c.TimeoutCount, 10),
+				strconv.Itoa(len(c.Clients)),
+				strconv.FormatBool(c.Paused),
+			}
+			var count int
+			values := make(map[float64]float64)
+			if c.E2eProcessingLatency != nil {
+				count = c.E2eProcessingLatency.Count
+				for _, item := range c.E2eProcessingLatency.Percentiles {
+					values[item["quantile"]] = item["value"]
+				}
+			}
+			record = append(record, strconv.Itoa(count))
+			for _, p := range percentiles {
+				var value string
+				if v, ok := values[p]; ok && count > 0 {
+					value = strconv.FormatFloat(v, 'f', -1, 64)
+				}
+				record = append(record, value)
+			}
+			w.Write(record)
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
 }
 
 func (s *httpServer) printStats(stats []TopicStats, ms memStats, health string, startTime time.Time, uptime time.Duration) []byte {
@@ -545,6 +1038,7 @@ func (s *httpServer) printStats(stats []TopicStats, ms memStats, health string,
 	fmt.Fprintf(w, "  %-25s\t%d\n", "gc_pause_usec_95", ms.GCPauseUsec95)
 	fmt.Fprintf(w, "  %-25s\t%d\n", "next_gc_bytes", ms.NextGCBytes)
 	fmt.Fprintf(w, "  %-25s\t%d\n", "gc_total_runs", ms.GCTotalRuns)
+	fmt.Fprintf(w, "  %-25s\t%d\n", "gc_total_pause_usec", ms.GCTotalPauseUsec)
 
 	io.WriteString(w, fmt.Sprintf("\nHealth: %s\n", health))
 	for _, t := range stats {
@@ -3,12 +3,14 @@ package nsqd
 import (
 	"bytes"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"sync"
@@ -57,6 +59,7 @@ func TestHTTPpub(t *testing.T) {
 	time.Sleep(5 * time.Millisecond)
 
 	test.Equal(t, int64(1), topic.Depth())
+	test.Equal(t, uint64(1), NewTopicStats(topic, nil, false).HTTPPublishCount)
 }
 
 func TestHTTPpubEmpty(t *testing.T) {
@@ -110,6 +113,7 @@ func TestHTTPmpub(t *testing.T) {
 	time.Sleep(5 * time.Millisecond)
 
 	test.Equal(t, int64(4), topic.Depth())
+	test.Equal(t, uint64(4), NewTopicStats(topic, nil, false).HTTPPublishCount)
 }
 
 func TestHTTPmpubEmpty(t *testing.T) {
@@ -226,6 +230,10 @@ func TestHTTPpubDefer(t *testing.T) {
 	numDef := len(ch.deferredMessages)
 	ch.deferredMutex.Unlock()
 	test.Equal(t, 1, numDef)
+
+	stats := nsqd.GetStats(topicName, "")
+	test.Equal(t, uint64(1), stats[0].DeferredPublishCount)
+	test.Equal(t, int64(time.Second), stats[0].MaxDeferredPublishDuration)
 }
 
 func TestHTTPSRequire(t *testing.T) {
@@ -539,6 +547,692 @@ func TestHTTPgetStatusText(t *testing.T) {
 	test.NotNil(t, body)
 }
 
+func TestHTTPgetStatusETag(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topic := nsqd.GetTopic("test_stats_etag" + strconv.Itoa(int(time.Now().Unix())))
+	topic.GetChannel("ch")
+
+	get := func(etag string, params ...string) (*http.Response, []byte) {
+		url := fmt.Sprintf("http://%s/stats?format=json", httpAddr)
+		for _, p := range params {
+			url += "&" + p
+		}
+		req, _ := http.NewRequest("GET", url, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		test.Nil(t, err)
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	resp, _ := get("")
+	test.Equal(t, 200, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	test.NotEqual(t, "", etag)
+
+	resp, body := get(etag)
+	test.Equal(t, 304, resp.StatusCode)
+	test.Equal(t, 0, len(body))
+
+	// invalid params are rejected before the ETag is computed
+	for _, p := range []string{"depth=bogus", "clients_sort=bogus", "clients_limit=-1",
+		"client_message_counts=bogus", "encode_names=bogus"} {
+		resp, _ = get(etag, p)
+		test.Equal(t, 400, resp.StatusCode)
+		test.Equal(t, "", resp.Header.Get("ETag"))
+	}
+
+	topic.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+
+	resp, _ = get(etag)
+	test.Equal(t, 200, resp.StatusCode)
+	test.NotEqual(t, etag, resp.Header.Get("ETag"))
+}
+
+func TestHTTPgetStatusFields(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_stats_fields" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	topic.GetChannel("ch")
+	topic.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+
+	url := fmt.Sprintf("http://%s/stats?format=json&fields=message_count,%%20bogus", httpAddr)
+	resp, err := http.Get(url)
+	test.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	test.Equal(t, 200, resp.StatusCode)
+	test.Equal(t, `299 nsqd "unknown fields: bogus"`, resp.Header.Get("Warning"))
+
+	t.Logf("%s", body)
+	var d struct {
+		Topics []map[string]json.RawMessage `json:"topics"`
+	}
+	err = json.Unmarshal(body, &d)
+	test.Nil(t, err)
+	test.Equal(t, 1, len(d.Topics))
+	test.Equal(t, 3, len(d.Topics[0]))
+	test.Equal(t, `"`+topicName+`"`, string(d.Topics[0]["topic_name"]))
+	test.Equal(t, "1", string(d.Topics[0]["message_count"]))
+
+	var channels []map[string]json.RawMessage
+	err = json.Unmarshal(d.Topics[0]["channels"], &channels)
+	test.Nil(t, err)
+	test.Equal(t, 1, len(channels))
+	test.Equal(t, 3, len(channels[0]))
+	test.Equal(t, "[]", string(channels[0]["clients"]))
+}
+
+func TestHTTPgetStatusMultipleTopics(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		nsqd.GetTopic("test_stats_topics_" + name)
+	}
+
+	var d struct {
+		Topics []struct {
+			TopicName string `json:"topic_name"`
+		} `json:"topics"`
+		CollectionDurationUsec *int64 `json:"collection_duration_usec"`
+	}
+	url := fmt.Sprintf("http://%s/stats?format=json"+
+		"&topic=test_stats_topics_d,test_stats_topics_a&topic=test_stats_topics_c&topic=missing", httpAddr)
+	resp, err := http.Get(url)
+	test.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	test.Equal(t, 200, resp.StatusCode)
+	err = json.Unmarshal(body, &d)
+	test.Nil(t, err)
+
+	test.NotNil(t, d.CollectionDurationUsec)
+	test.Equal(t, 3, len(d.Topics))
+	test.Equal(t, "test_stats_topics_a", d.Topics[0].TopicName)
+	test.Equal(t, "test_stats_topics_c", d.Topics[1].TopicName)
+	test.Equal(t, "test_stats_topics_d", d.Topics[2].TopicName)
+}
+
+func TestHTTPgetStatusEncodeNames(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_stats_encode_names" + strconv.Itoa(int(time.Now().Unix()))
+	nsqd.GetTopic(topicName).GetChannel("ch#ephemeral")
+
+	var d struct {
+		Topics []struct {
+			TopicNameEncoded string `json:"topic_name_encoded"`
+			Channels         []struct {
+				ChannelNameEncoded string `json:"channel_name_encoded"`
+			} `json:"channels"`
+		} `json:"topics"`
+	}
+	get := func(url string) {
+		resp, err := http.Get(url)
+		test.Nil(t, err)
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		test.Equal(t, 200, resp.StatusCode)
+		err = json.Unmarshal(body, &d)
+		test.Nil(t, err)
+	}
+
+	url := fmt.Sprintf("http://%s/stats?format=json&topic=%s", httpAddr, topicName)
+	get(url)
+	test.Equal(t, "", d.Topics[0].TopicNameEncoded)
+	test.Equal(t, "", d.Topics[0].Channels[0].ChannelNameEncoded)
+
+	get(url + "&encode_names=true")
+	test.Equal(t, base64.URLEncoding.EncodeToString([]byte(topicName)), d.Topics[0].TopicNameEncoded)
+	test.Equal(t, "Y2gjZXBoZW1lcmFs", d.Topics[0].Channels[0].ChannelNameEncoded)
+
+	resp, err := http.Get(url + "&encode_names=maybe")
+	test.Nil(t, err)
+	resp.Body.Close()
+	test.Equal(t, 400, resp.StatusCode)
+}
+
+func TestHTTPStatsApproximateDepth(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_stats_approximate_depth" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("ch")
+	// paused so that the messagePump leaves the message in the topic
+	topic.Pause()
+	topic.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	channel.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	topic.sampleDepth()
+	channel.sampleDepth(opts.DepthEWMAAlpha)
+
+	var d struct {
+		Topics []struct {
+			Depth    int64 `json:"depth"`
+			Channels []struct {
+				Depth int64 `json:"depth"`
+			} `json:"channels"`
+		} `json:"topics"`
+	}
+	url := fmt.Sprintf("http://%s/stats?format=json&topic=%s", httpAddr, topicName)
+	resp, err := http.Get(url + "&depth=approximate")
+	test.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	test.Equal(t, 200, resp.StatusCode)
+	err = json.Unmarshal(body, &d)
+	test.Nil(t, err)
+	test.Equal(t, int64(1), d.Topics[0].Depth)
+	test.Equal(t, int64(1), d.Topics[0].Channels[0].Depth)
+
+	resp, err = http.Get(url + "&depth=roughly")
+	test.Nil(t, err)
+	resp.Body.Close()
+	test.Equal(t, 400, resp.StatusCode)
+}
+
+func TestHTTPStatsHistory(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.StatsHistorySize = 60
+	// long enough that statsHistoryLoop does not add any points of its own
+	opts.StatsHistoryInterval = time.Hour
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_stats_history" + strconv.Itoa(int(time.Now().Unix()))
+	nsqd.GetTopic(topicName).GetChannel("ch")
+	nsqd.GetTopic("other").GetChannel("ch")
+	for i := 0; i < 3; i++ {
+		nsqd.statsHistory.add(newStatsHistoryPoint(nsqd.GetStats("", ""), time.Now()))
+	}
+
+	var d struct {
+		IntervalMs int64 `json:"interval_ms"`
+		Points     []struct {
+			Topics []struct {
+				TopicName string `json:"topic_name"`
+			} `json:"topics"`
+		} `json:"points"`
+	}
+	url := fmt.Sprintf("http://%s/stats/history?topic=%s", httpAddr, topicName)
+	resp, err := http.Get(url + "&n=2")
+	test.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	test.Equal(t, 200, resp.StatusCode)
+	err = json.Unmarshal(body, &d)
+	test.Nil(t, err)
+	test.Equal(t, int64(time.Hour/time.Millisecond), d.IntervalMs)
+	test.Equal(t, 2, len(d.Points))
+	test.Equal(t, 1, len(d.Points[0].Topics))
+	test.Equal(t, topicName, d.Points[0].Topics[0].TopicName)
+
+	resp, err = http.Get(url + "&n=-1")
+	test.Nil(t, err)
+	resp.Body.Close()
+	test.Equal(t, 400, resp.StatusCode)
+}
+
+func TestHTTPStatsDelta(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_stats_delta" + strconv.Itoa(int(time.Now().Unix()))
+	channel := nsqd.GetTopic(topicName).GetChannel("ch")
+
+	var d StatsDelta
+	get := func(url string) {
+		resp, err := http.Get(url)
+		test.Nil(t, err)
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		test.Equal(t, 200, resp.StatusCode)
+		d = StatsDelta{}
+		err = json.Unmarshal(body, &d)
+		test.Nil(t, err)
+	}
+
+	url := fmt.Sprintf("http://%s/stats/delta?topic=%s", httpAddr, topicName)
+	get(url)
+	test.Equal(t, true, d.Reset)
+
+	channel.PutMessage(NewMessage(nsqd.GetTopic(topicName).GenerateID(), []byte("test")))
+	get(url + "&token=" + d.Token)
+	test.Equal(t, false, d.Reset)
+	test.Equal(t, json.Number("1"), d.Changes[topicName+":ch"]["depth"])
+}
+
+func TestHTTPgetStatusCSV(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_stats_csv" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	topic.GetChannel("ch2")
+	channel := topic.GetChannel("ch1")
+	channel.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+
+	url := fmt.Sprintf("http://%s/stats/csv", httpAddr)
+	resp, err := http.Get(url)
+	test.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	test.Equal(t, 200, resp.StatusCode)
+	test.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	t.Logf("%s", body)
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	test.Equal(t, 3, len(lines))
+	test.Equal(t, "topic,channel,depth,backend_depth,in_flight_count,deferred_count,"+
+		"message_count,requeue_count,timeout_count,client_count,paused,e2e_processing_latency_count", lines[0])
+	test.Equal(t, topicName+",ch1,1,0,0,0,1,0,0,0,false,0", lines[1])
+	test.Equal(t, topicName+",ch2,0,0,0,0,0,0,0,0,false,0", lines[2])
+}
+
+func TestHTTPgetClusterStats(t *testing.T) {
+	opts1 := NewOptions()
+	opts1.Logger = test.NewTestLogger(t)
+	_, httpAddr1, nsqd1 := mustStartNSQD(opts1)
+	defer os.RemoveAll(opts1.DataPath)
+	defer nsqd1.Exit()
+
+	opts2 := NewOptions()
+	opts2.Logger = test.NewTestLogger(t)
+	_, httpAddr2, nsqd2 := mustStartNSQD(opts2)
+	defer os.RemoveAll(opts2.DataPath)
+	defer nsqd2.Exit()
+
+	url := fmt.Sprintf("http://%s/stats/cluster", httpAddr1)
+	resp, err := http.Get(url)
+	test.Nil(t, err)
+	test.Equal(t, 404, resp.StatusCode)
+	resp.Body.Close()
+
+	newOpts := *nsqd1.getOpts()
+	newOpts.StatsClusterNodes = []string{httpAddr1.String(), httpAddr2.String()}
+	nsqd1.swapOpts(&newOpts)
+
+	topicName := "test_cluster_stats" + strconv.Itoa(int(time.Now().Unix()))
+	for _, n := range []*NSQD{nsqd1, nsqd2} {
+		topic := n.GetTopic(topicName)
+		topic.GetChannel("ch")
+		topic.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	}
+	nsqd2.GetTopic(topicName).GetChannel("ch2")
+
+	var d struct {
+		Topics []struct {
+			TopicName    string `json:"topic_name"`
+			MessageCount int64  `json:"message_count"`
+			Nodes        []struct {
+				MessageCount int64 `json:"message_count"`
+			} `json:"nodes"`
+			Channels []struct {
+				ChannelName  string `json:"channel_name"`
+				MessageCount int64  `json:"message_count"`
+			} `json:"channels"`
+		} `json:"topics"`
+	}
+	for i := 0; i < 100; i++ {
+		resp, err = http.Get(url)
+		test.Nil(t, err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		test.Equal(t, 200, resp.StatusCode)
+		err = json.Unmarshal(body, &d)
+		test.Nil(t, err)
+		if len(d.Topics) == 1 && d.Topics[0].MessageCount == 2 && len(d.Topics[0].Channels) == 2 &&
+			d.Topics[0].Channels[0].MessageCount == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	test.Equal(t, 1, len(d.Topics))
+	test.Equal(t, topicName, d.Topics[0].TopicName)
+	test.Equal(t, int64(2), d.Topics[0].MessageCount)
+	test.Equal(t, 2, len(d.Topics[0].Nodes))
+	test.Equal(t, int64(1), d.Topics[0].Nodes[0].MessageCount)
+	test.Equal(t, 2, len(d.Topics[0].Channels))
+	test.Equal(t, "ch", d.Topics[0].Channels[0].ChannelName)
+	test.Equal(t, int64(2), d.Topics[0].Channels[0].MessageCount)
+	test.Equal(t, "ch2", d.Topics[0].Channels[1].ChannelName)
+}
+
+func TestHTTPgetE2eSamples(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.E2EProcessingLatencyPercentiles = []float64{0.99}
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_e2e_samples" + strconv.Itoa(int(time.Now().Unix()))
+	channel := nsqd.GetTopic(topicName).GetChannel("ch")
+	for i := 0; i < 5; i++ {
+		channel.e2eProcessingLatencyStream.Insert(time.Now().Add(-time.Second).UnixNano())
+	}
+
+	var d struct {
+		Count     int  `json:"count"`
+		Truncated bool `json:"truncated"`
+		Samples   []struct {
+			Value float64 `json:"value"`
+			Width float64 `json:"width"`
+		} `json:"samples"`
+	}
+	url := fmt.Sprintf("http://%s/stats/e2e_samples?topic=%s&channel=ch&limit=2", httpAddr, topicName)
+	resp, err := http.Get(url)
+	test.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	test.Equal(t, 200, resp.StatusCode)
+	err = json.Unmarshal(body, &d)
+	test.Nil(t, err)
+
+	test.Equal(t, true, d.Count > 0)
+	test.Equal(t, d.Count > 2, d.Truncated)
+	test.Equal(t, true, len(d.Samples) <= 2)
+	test.Equal(t, true, d.Samples[0].Value >= float64(time.Second))
+
+	url = fmt.Sprintf("http://%s/stats/e2e_samples?topic=%s&channel=missing", httpAddr, topicName)
+	resp, err = http.Get(url)
+	test.Nil(t, err)
+	resp.Body.Close()
+	test.Equal(t, 404, resp.StatusCode)
+}
+
+func TestHTTPStatsSnapshot(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_stats_snapshot" + strconv.Itoa(int(time.Now().Unix()))
+	nsqd.GetTopic(topicName).GetChannel("ch")
+
+	url := fmt.Sprintf("http://%s/stats/snapshot", httpAddr)
+	var fileName string
+	for i := 0; i < maxStatsSnapshots+2; i++ {
+		resp, err := http.Post(url, "application/json", nil)
+		test.Nil(t, err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		test.Equal(t, 200, resp.StatusCode)
+
+		var d struct {
+			Path string `json:"path"`
+		}
+		err = json.Unmarshal(body, &d)
+		test.Nil(t, err)
+		fileName = d.Path
+	}
+
+	snapshots, _ := filepath.Glob(filepath.Join(opts.DataPath, "nsqd.stats.*.json"))
+	test.Equal(t, maxStatsSnapshots, len(snapshots))
+	test.Equal(t, fileName, snapshots[len(snapshots)-1])
+
+	data, err := ioutil.ReadFile(fileName)
+	test.Nil(t, err)
+	var snapshot struct {
+		Topics []TopicStats `json:"topics"`
+		Memory *memStats    `json:"memory"`
+	}
+	err = json.Unmarshal(data, &snapshot)
+	test.Nil(t, err)
+	test.Equal(t, 1, len(snapshot.Topics))
+	test.Equal(t, topicName, snapshot.Topics[0].TopicName)
+	test.NotNil(t, snapshot.Memory)
+}
+
+func TestHTTPTopicE2eWindow(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.E2EProcessingLatencyPercentiles = []float64{0.99}
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_e2e_window" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("ch1")
+
+	stats := nsqd.GetStats(topicName, "")
+	test.Equal(t, int64(opts.E2EProcessingLatencyWindowTime), stats[0].E2eProcessingLatencyWindow)
+	test.Equal(t, 2, stats[0].E2eProcessingLatencySubWindows)
+
+	for _, params := range []string{
+		"window=30s&sub_windows=0",
+		"window=30s&sub_windows=61",
+		"window=1ns&sub_windows=2",
+		"window=500ms&sub_windows=1",
+		"window=3s&sub_windows=4",
+	} {
+		url := fmt.Sprintf("http://%s/topic/e2e_window?topic=%s&%s", httpAddr, topicName, params)
+		resp, err := http.Post(url, "application/json", nil)
+		test.Nil(t, err)
+		test.Equal(t, 400, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	url := fmt.Sprintf("http://%s/topic/e2e_window?topic=%s&window=30s&sub_windows=6", httpAddr, topicName)
+	resp, err := http.Post(url, "application/json", nil)
+	test.Nil(t, err)
+	test.Equal(t, 200, resp.StatusCode)
+	resp.Body.Close()
+
+	stats = nsqd.GetStats(topicName, "")
+	test.Equal(t, int64(30*time.Second), stats[0].E2eProcessingLatencyWindow)
+	test.Equal(t, 6, stats[0].E2eProcessingLatencySubWindows)
+
+	// applies to both existing and new channels
+	windowTime, subWindows := channel.e2eProcessingLatencyStream.Window()
+	test.Equal(t, 30*time.Second, windowTime)
+	test.Equal(t, 6, subWindows)
+	windowTime, subWindows = topic.GetChannel("ch2").e2eProcessingLatencyStream.Window()
+	test.Equal(t, 30*time.Second, windowTime)
+	test.Equal(t, 6, subWindows)
+
+	channel.e2eProcessingLatencyStream.Insert(time.Now().Add(-time.Second).UnixNano())
+	stats = nsqd.GetStats(topicName, "")
+	test.Equal(t, 1, stats[0].E2eProcessingLatency.Count)
+}
+
+func TestHTTPResetChannelE2e(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.E2EProcessingLatencyPercentiles = []float64{0.99}
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_reset_channel_e2e" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("ch")
+	channel.e2eProcessingLatencyStream.Insert(time.Now().Add(-time.Second).UnixNano())
+	test.Equal(t, 1, channel.e2eProcessingLatencyStream.Result().Count)
+
+	url := fmt.Sprintf("http://%s/channel/e2e_reset?topic=%s&channel=missing", httpAddr, topicName)
+	resp, err := http.Post(url, "application/json", nil)
+	test.Nil(t, err)
+	test.Equal(t, 404, resp.StatusCode)
+	resp.Body.Close()
+
+	url = fmt.Sprintf("http://%s/channel/e2e_reset?topic=%s&channel=ch", httpAddr, topicName)
+	resp, err = http.Post(url, "application/json", nil)
+	test.Nil(t, err)
+	test.Equal(t, 200, resp.StatusCode)
+	resp.Body.Close()
+	test.Equal(t, 0, channel.e2eProcessingLatencyStream.Result().Count)
+
+	// still collecting after the reset
+	channel.e2eProcessingLatencyStream.Insert(time.Now().Add(-time.Second).UnixNano())
+	test.Equal(t, 1, channel.e2eProcessingLatencyStream.Result().Count)
+}
+
+func TestHTTPStatsAlerts(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_stats_alerts" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	topic.GetChannel("ch")
+	// hold the messages in the topic
+	topic.Pause()
+	for i := 0; i < 3; i++ {
+		topic.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	}
+
+	url := fmt.Sprintf("http://%s/stats/alerts", httpAddr)
+	resp, err := http.Get(url)
+	test.Nil(t, err)
+	resp.Body.Close()
+	test.Equal(t, 404, resp.StatusCode)
+
+	newOpts := *opts
+	newOpts.AlertDepthThreshold = 2
+	nsqd.swapOpts(&newOpts)
+
+	resp, err = http.Get(url)
+	test.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	test.Equal(t, 200, resp.StatusCode)
+
+	var alerts struct {
+		Alerts []StatsAlert `json:"alerts"`
+	}
+	err = json.Unmarshal(body, &alerts)
+	test.Nil(t, err)
+	test.Equal(t, []StatsAlert{{topicName, "", "depth", 3, 2}}, alerts.Alerts)
+}
+
+func TestHTTPgetMemStats(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	nsqd.GetTopic("test_mem_stats" + strconv.Itoa(int(time.Now().Unix())))
+
+	url := fmt.Sprintf("http://%s/stats/mem", httpAddr)
+	resp, err := http.Get(url)
+	test.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	test.Equal(t, 200, resp.StatusCode)
+
+	t.Logf("%s", body)
+	var ms map[string]interface{}
+	err = json.Unmarshal(body, &ms)
+	test.Nil(t, err)
+	_, ok := ms["heap_objects"]
+	test.Equal(t, true, ok)
+	_, ok = ms["topics"]
+	test.Equal(t, false, ok)
+}
+
+func TestHTTPStatsTopology(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_stats_topology" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	topic.GetChannel("ch2")
+	topic.GetChannel("ch1")
+	nsqd.GetTopic("a" + topicName)
+
+	url := fmt.Sprintf("http://%s/stats/topology", httpAddr)
+	resp, err := http.Get(url)
+	test.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	test.Equal(t, 200, resp.StatusCode)
+
+	var topology struct {
+		Topics []TopologyTopic `json:"topics"`
+	}
+	err = json.Unmarshal(body, &topology)
+	test.Nil(t, err)
+	test.Equal(t, []TopologyTopic{
+		{"a" + topicName, []string{}},
+		{topicName, []string{"ch1", "ch2"}},
+	}, topology.Topics)
+}
+
+func TestHTTPStatsProfile(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	test.Equal(t, StatsProfile{}, nsqd.GetStatsProfile())
+
+	topicName := "test_stats_profile" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	topic.GetChannel("ch1")
+	topic.GetChannel("ch2")
+	before := time.Now().UnixNano()
+	nsqd.GetStats(topicName, "")
+
+	url := fmt.Sprintf("http://%s/stats/profile", httpAddr)
+	resp, err := http.Get(url)
+	test.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	test.Equal(t, 200, resp.StatusCode)
+
+	var profile StatsProfile
+	err = json.Unmarshal(body, &profile)
+	test.Nil(t, err)
+	test.Equal(t, 1, profile.TopicCount)
+	test.Equal(t, 2, profile.ChannelCount)
+	if profile.CollectedTimestamp < before {
+		t.Fatalf("profile collected at %d, before GetStats at %d", profile.CollectedTimestamp, before)
+	}
+}
+
 func TestHTTPconfig(t *testing.T) {
 	lopts := nsqlookupd.NewOptions()
 	lopts.Logger = test.NewTestLogger(t)
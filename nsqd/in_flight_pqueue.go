@@ -69,6 +69,27 @@ func (pq *inFlightPqueue) PeekAndShift(max int64) (*Message, int64) {
 	return x, 0
 }
 
+// CountBefore returns the number of messages with a priority <= max, because
+// of the heap ordering it only visits those messages (and their children)
+func (pq inFlightPqueue) CountBefore(max int64) int {
+	var count int
+	if len(pq) == 0 || pq[0].pri > max {
+		return 0
+	}
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		count++
+		for _, j := range []int{2*i + 1, 2*i + 2} {
+			if j < len(pq) && pq[j].pri <= max {
+				stack = append(stack, j)
+			}
+		}
+	}
+	return count
+}
+
 func (pq *inFlightPqueue) up(j int) {
 	for {
 		i := (j - 1) / 2 // parent
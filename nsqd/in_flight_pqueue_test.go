@@ -47,6 +47,20 @@ func TestUnsortedInsert(t *testing.T) {
 	}
 }
 
+func TestCountBefore(t *testing.T) {
+	c := 100
+	pq := newInFlightPqueue(c)
+
+	test.Equal(t, 0, pq.CountBefore(50))
+	for _, i := range rand.Perm(c) {
+		pq.Push(&Message{pri: int64(i)})
+	}
+	test.Equal(t, 0, pq.CountBefore(-1))
+	test.Equal(t, 1, pq.CountBefore(0))
+	test.Equal(t, 51, pq.CountBefore(50))
+	test.Equal(t, c, pq.CountBefore(int64(c)))
+}
+
 func TestRemove(t *testing.T) {
 	c := 100
 	pq := newInFlightPqueue(c)
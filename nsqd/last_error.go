@@ -0,0 +1,42 @@
+package nsqd
+
+import (
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLastErrorLength bounds the (byte) length of a lastError message
+const maxLastErrorLength = 256
+
+// lastError is the most recent error (truncated to maxLastErrorLength) and
+// when (in ns) it happened
+type lastError struct {
+	sync.Mutex
+	msg string
+	at  int64
+}
+
+func (e *lastError) set(err error) {
+	if err == nil {
+		return
+	}
+	msg := err.Error()
+	if len(msg) > maxLastErrorLength {
+		msg = msg[:maxLastErrorLength]
+		// don't leave a partial rune at the end
+		for len(msg) > 0 && !utf8.ValidString(msg) {
+			msg = msg[:len(msg)-1]
+		}
+	}
+	e.Lock()
+	e.msg = msg
+	e.at = time.Now().UnixNano()
+	e.Unlock()
+}
+
+func (e *lastError) get() (string, int64) {
+	e.Lock()
+	defer e.Unlock()
+	return e.msg, e.at
+}
@@ -1,6 +1,9 @@
 package nsqd
 
 import (
+	"strings"
+	"sync/atomic"
+
 	"github.com/nsqio/nsq/internal/lg"
 )
 
@@ -18,3 +21,14 @@ func (n *NSQD) logf(level lg.LogLevel, f string, args ...interface{}) {
 	opts := n.getOpts()
 	lg.Logf(opts.Logger, opts.logLevel, level, f, args...)
 }
+
+// httpsLogf is logf for the HTTPS server, net/http only reports failed TLS
+// handshakes through its ErrorLog so they are counted here
+func (n *NSQD) httpsLogf(level lg.LogLevel, f string, args ...interface{}) {
+	if len(args) == 1 {
+		if msg, ok := args[0].(string); ok && strings.HasPrefix(msg, "http: TLS handshake error") {
+			atomic.AddUint64(&n.tlsHandshakeFailureCount, 1)
+		}
+	}
+	n.logf(level, f, args...)
+}
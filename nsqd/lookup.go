@@ -181,6 +181,26 @@ func in(s string, lst []string) bool {
 	return false
 }
 
+// GetLookupdStats returns the connection state of each --lookupd-tcp-address
+func (n *NSQD) GetLookupdStats() []LookupdStats {
+	peers := make(map[string]*lookupPeer)
+	if lookupPeers := n.lookupPeers.Load(); lookupPeers != nil {
+		for _, lp := range lookupPeers.([]*lookupPeer) {
+			peers[lp.addr] = lp
+		}
+	}
+	addrs := n.getOpts().NSQLookupdTCPAddresses
+	stats := make([]LookupdStats, 0, len(addrs))
+	for _, addr := range addrs {
+		lp, ok := peers[addr]
+		stats = append(stats, LookupdStats{
+			Address:   addr,
+			Connected: ok && lp.IsConnected(),
+		})
+	}
+	return stats
+}
+
 func (n *NSQD) lookupdHTTPAddrs() []string {
 	var lookupHTTPAddrs []string
 	lookupPeers := n.lookupPeers.Load()
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/nsqio/go-nsq"
@@ -58,6 +59,12 @@ func (lp *lookupPeer) Connect() error {
 	return nil
 }
 
+// IsConnected returns whether the last attempt to connect (or round-trip a
+// command) succeeded, it is safe to call from any goroutine
+func (lp *lookupPeer) IsConnected() bool {
+	return atomic.LoadInt32(&lp.state) == stateConnected
+}
+
 // String returns the specified address
 func (lp *lookupPeer) String() string {
 	return lp.addr
@@ -77,7 +84,7 @@ func (lp *lookupPeer) Write(data []byte) (int, error) {
 
 // Close implements the io.Closer interface
 func (lp *lookupPeer) Close() error {
-	lp.state = stateDisconnected
+	atomic.StoreInt32(&lp.state, stateDisconnected)
 	if lp.conn != nil {
 		return lp.conn.Close()
 	}
@@ -91,13 +98,13 @@ func (lp *lookupPeer) Close() error {
 //
 // It returns the response from nsqlookupd as []byte
 func (lp *lookupPeer) Command(cmd *nsq.Command) ([]byte, error) {
-	initialState := lp.state
-	if lp.state != stateConnected {
+	initialState := atomic.LoadInt32(&lp.state)
+	if initialState != stateConnected {
 		err := lp.Connect()
 		if err != nil {
 			return nil, err
 		}
-		lp.state = stateConnected
+		atomic.StoreInt32(&lp.state, stateConnected)
 		lp.Write(nsq.MagicV1)
 		if initialState == stateDisconnected {
 			lp.connectCallback(lp)
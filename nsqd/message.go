@@ -27,6 +27,15 @@ type Message struct {
 	pri        int64
 	index      int
 	deferred   time.Duration
+
+	// when (in ns) the message entered the channel, for dwell time, it is not
+	// written to the backend
+	enqueuedAt int64
+
+	// when (in ns) the message was last put in the channel's queue (initially,
+	// after a requeue or once its defer is up), for dispatch latency, it is
+	// not written to the backend either
+	deliverableAt int64
 }
 
 func NewMessage(id MessageID, body []byte) *Message {
@@ -65,6 +74,12 @@ func (m *Message) WriteTo(w io.Writer) (int64, error) {
 	return total, nil
 }
 
+// messageSize is the size of m as written to a backend (without the length
+// prefix), ie. its header and body
+func messageSize(m *Message) int64 {
+	return int64(minValidMsgLength + len(m.Body))
+}
+
 // decodeMessage deserializes data (as []byte) and creates a new Message
 // message format:
 // [x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x][x]...
@@ -13,7 +13,9 @@ import (
 	"net"
 	"os"
 	"path"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -42,6 +44,30 @@ type errStore struct {
 type NSQD struct {
 	// 64bit atomic vars need to be first for proper alignment on 32bit platforms
 	clientIDSequence int64
+	clientCount      int64
+
+	// duration (in ns) of the last PersistMetadata and time (in ns) of the
+	// last successful one
+	lastMetadataPersistDuration int64
+	lastMetadataPersistAt       int64
+
+	// incoming TLS handshakes that failed, on the TCP (IDENTIFY upgrade) and
+	// HTTPS listeners
+	tlsHandshakeFailureCount uint64
+
+	// IDENTIFYs asking for disabled (or both deflate and snappy) compression
+	compressionNegotiationFailureCount uint64
+
+	// SUBs currently getting (or creating) their topic and channel, which
+	// takes the NSQD, topic and channel locks
+	blockedSubCount int64
+
+	// failed NewGUID calls (time going backwards or the sequence running out
+	// within a pseudo-millisecond), GenerateID retries after each
+	guidErrorCount uint64
+
+	// TCP connections handled, nsqd does not limit (or reject) them
+	acceptedConnectionCount uint64
 
 	sync.RWMutex
 
@@ -49,6 +75,8 @@ type NSQD struct {
 
 	dl        *dirlock.DirLock
 	isLoading int32
+	// set at the start of Exit, see IsDraining
+	draining  int32
 	errValue  atomic.Value
 	startTime time.Time
 
@@ -56,6 +84,9 @@ type NSQD struct {
 
 	lookupPeers atomic.Value
 
+	// StatsProfile of the most recent stats collection
+	statsProfile atomic.Value
+
 	tcpListener   net.Listener
 	httpListener  net.Listener
 	httpsListener net.Listener
@@ -69,6 +100,15 @@ type NSQD struct {
 	waitGroup            util.WaitGroupWrapper
 
 	ci *clusterinfo.ClusterInfo
+
+	// nil when --stats-history-size is 0
+	statsHistory *statsHistory
+
+	statsDeltas statsDeltas
+
+	// open TCP connections by clientV2.version, see moveClientVersion
+	clientVersionsLock sync.Mutex
+	clientVersions     map[string]int
 }
 
 func New(opts *Options) *NSQD {
@@ -88,6 +128,7 @@ func New(opts *Options) *NSQD {
 		notifyChan:           make(chan interface{}),
 		optsNotificationChan: make(chan struct{}, 1),
 		dl:                   dirlock.New(dataPath),
+		clientVersions:       make(map[string]int),
 	}
 	httpcli := http_api.NewClient(nil, opts.HTTPClientConnectTimeout, opts.HTTPClientRequestTimeout)
 	n.ci = clusterinfo.New(n.logf, httpcli)
@@ -148,6 +189,34 @@ func New(opts *Options) *NSQD {
 	}
 	n.tlsConfig = tlsConfig
 
+	if opts.DepthEWMAAlpha <= 0 || opts.DepthEWMAAlpha > 1 {
+		n.logf(LOG_FATAL, "--depth-ewma-alpha must be (0,1]")
+		os.Exit(1)
+	}
+
+	qualityWeights := []float64{opts.QualityScoreIdleWeight, opts.QualityScoreWriteErrorWeight,
+		opts.QualityScoreRdyWeight, opts.QualityScoreNearTimeoutWeight}
+	var qualityWeightSum float64
+	for _, w := range qualityWeights {
+		if w < 0 {
+			n.logf(LOG_FATAL, "--quality-score-*-weight must be >= 0")
+			os.Exit(1)
+		}
+		qualityWeightSum += w
+	}
+	if qualityWeightSum == 0 {
+		n.logf(LOG_FATAL, "at least one --quality-score-*-weight must be > 0")
+		os.Exit(1)
+	}
+
+	if opts.StatsHistorySize > 0 {
+		if opts.StatsHistoryInterval <= 0 {
+			n.logf(LOG_FATAL, "--stats-history-interval must be > 0")
+			os.Exit(1)
+		}
+		n.statsHistory = newStatsHistory(opts.StatsHistorySize)
+	}
+
 	for _, v := range opts.E2EProcessingLatencyPercentiles {
 		if v <= 0 || v > 1 {
 			n.logf(LOG_FATAL, "Invalid percentile: %v", v)
@@ -215,10 +284,68 @@ func (n *NSQD) GetHealth() string {
 	return "OK"
 }
 
+// IsDraining returns whether Exit has been called, ie. the node has stopped
+// accepting TCP connections and is shutting down. Exit keeps serving HTTP(S)
+// for --drain-duration so that this can be seen in /stats.
+func (n *NSQD) IsDraining() bool {
+	return atomic.LoadInt32(&n.draining) == 1
+}
+
+// GetDegraded rolls up several signals into a single degraded flag, returning
+// it along with the reasons. nsqd is degraded when it is not healthy (ie. the
+// most recent write to a backend failed), when --degraded-min-free-bytes is set
+// and --data-path has less space free, or when --degraded-max-goroutines is set
+// and more goroutines are running
+func (n *NSQD) GetDegraded() (bool, []string) {
+	var reasons []string
+	if err := n.GetError(); err != nil {
+		reasons = append(reasons, fmt.Sprintf("backend error - %s", err))
+	}
+
+	opts := n.getOpts()
+	if opts.DegradedMinFreeBytes > 0 {
+		dataPath := opts.DataPath
+		if dataPath == "" {
+			dataPath = "."
+		}
+		free, err := diskFreeBytes(dataPath)
+		if err != nil {
+			n.logf(LOG_WARN, "failed to get free space of %s - %s", dataPath, err)
+		} else if free < opts.DegradedMinFreeBytes {
+			reasons = append(reasons, fmt.Sprintf("%d bytes free in data path (min %d)",
+				free, opts.DegradedMinFreeBytes))
+		}
+	}
+
+	if opts.DegradedMaxGoroutines > 0 {
+		if goroutines := runtime.NumGoroutine(); goroutines > opts.DegradedMaxGoroutines {
+			reasons = append(reasons, fmt.Sprintf("%d goroutines running (max %d)",
+				goroutines, opts.DegradedMaxGoroutines))
+		}
+	}
+
+	return len(reasons) > 0, reasons
+}
+
 func (n *NSQD) GetStartTime() time.Time {
 	return n.startTime
 }
 
+// GetClientCount returns the number of open TCP connections, subscribed or not
+func (n *NSQD) GetClientCount() int {
+	return int(atomic.LoadInt64(&n.clientCount))
+}
+
+// goroutinesPerClient is the number of goroutines each TCP client connection
+// runs, the one (started by TCPServer) running IOLoop and its messagePump
+const goroutinesPerClient = 2
+
+// GetClientGoroutines is an estimate of the goroutines running for client
+// connections, some of runtime.NumGoroutine()
+func (n *NSQD) GetClientGoroutines() int {
+	return n.GetClientCount() * goroutinesPerClient
+}
+
 func (n *NSQD) Main() {
 	var httpListener net.Listener
 	var httpsListener net.Listener
@@ -249,7 +376,7 @@ func (n *NSQD) Main() {
 		n.Unlock()
 		httpsServer := newHTTPServer(ctx, true, true)
 		n.waitGroup.Wrap(func() {
-			http_api.Serve(n.httpsListener, httpsServer, "HTTPS", n.logf)
+			http_api.Serve(n.httpsListener, httpsServer, "HTTPS", n.httpsLogf)
 		})
 	}
 	httpListener, err = net.Listen("tcp", n.getOpts().HTTPAddress)
@@ -267,6 +394,10 @@ func (n *NSQD) Main() {
 
 	n.waitGroup.Wrap(func() { n.queueScanLoop() })
 	n.waitGroup.Wrap(func() { n.lookupLoop() })
+	n.waitGroup.Wrap(func() { n.depthSampleLoop() })
+	if n.statsHistory != nil {
+		n.waitGroup.Wrap(func() { n.statsHistoryLoop() })
+	}
 	if n.getOpts().StatsdAddress != "" {
 		n.waitGroup.Wrap(func() { n.statsdLoop() })
 	}
@@ -377,6 +508,27 @@ func (n *NSQD) LoadMetadata() error {
 }
 
 func (n *NSQD) PersistMetadata() error {
+	start := time.Now()
+	err := n.persistMetadata()
+	atomic.StoreInt64(&n.lastMetadataPersistDuration, int64(time.Since(start)))
+	if err == nil {
+		atomic.StoreInt64(&n.lastMetadataPersistAt, time.Now().UnixNano())
+	}
+	return err
+}
+
+// GetMetadataPersistStats returns the duration (in ns) of the last metadata
+// persist (successful or not) and the time (in ns) since the last successful
+// one, zero if it has not been persisted yet
+func (n *NSQD) GetMetadataPersistStats() (int64, int64) {
+	var age int64
+	if lastPersistAt := atomic.LoadInt64(&n.lastMetadataPersistAt); lastPersistAt != 0 {
+		age = int64(time.Since(time.Unix(0, lastPersistAt)))
+	}
+	return atomic.LoadInt64(&n.lastMetadataPersistDuration), age
+}
+
+func (n *NSQD) persistMetadata() error {
 	// persist metadata about what topics/channels we have, across restarts
 	fileName := newMetadataFile(n.getOpts())
 	// old metadata filename with ID, maintained in parallel to enable roll-back
@@ -461,11 +613,70 @@ func (n *NSQD) PersistMetadata() error {
 	return nil
 }
 
+// maxStatsSnapshots is how many stats snapshot files are kept in --data-path,
+// the oldest are removed as new ones are written
+const maxStatsSnapshots = 5
+
+// WriteStatsSnapshot writes the full stats (and memory stats) to a timestamped
+// file in --data-path for post-mortem analysis and returns its name
+func (n *NSQD) WriteStatsSnapshot() (string, error) {
+	now := time.Now()
+	// the fixed width timestamp keeps the files in chronological order by name
+	fileName := path.Join(n.getOpts().DataPath,
+		fmt.Sprintf("nsqd.stats.%s.json", now.UTC().Format("20060102T150405.000000000")))
+
+	n.logf(LOG_INFO, "NSQ: writing stats snapshot to %s", fileName)
+
+	data, err := json.Marshal(struct {
+		Version   string       `json:"version"`
+		Health    string       `json:"health"`
+		StartTime int64        `json:"start_time"`
+		Timestamp int64        `json:"timestamp"`
+		Topics    []TopicStats `json:"topics"`
+		Memory    memStats     `json:"memory"`
+	}{version.Binary, n.GetHealth(), n.GetStartTime().Unix(), now.Unix(),
+		n.GetStats("", ""), getMemStats()})
+	if err != nil {
+		return "", err
+	}
+
+	tmpFileName := fmt.Sprintf("%s.%d.tmp", fileName, rand.Int())
+	err = writeSyncFile(tmpFileName, data)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(tmpFileName, fileName)
+	if err != nil {
+		return "", err
+	}
+
+	snapshots, err := filepath.Glob(path.Join(n.getOpts().DataPath, "nsqd.stats.*.json"))
+	if err != nil {
+		return fileName, err
+	}
+	sort.Strings(snapshots)
+	for len(snapshots) > maxStatsSnapshots {
+		err = os.Remove(snapshots[0])
+		if err != nil {
+			n.logf(LOG_ERROR, "failed to remove stats snapshot %s - %s", snapshots[0], err)
+		}
+		snapshots = snapshots[1:]
+	}
+	return fileName, nil
+}
+
 func (n *NSQD) Exit() {
+	atomic.StoreInt32(&n.draining, 1)
+
 	if n.tcpListener != nil {
 		n.tcpListener.Close()
 	}
 
+	if drainDuration := n.getOpts().DrainDuration; drainDuration > 0 {
+		n.logf(LOG_INFO, "NSQ: draining for %s", drainDuration)
+		time.Sleep(drainDuration)
+	}
+
 	if n.httpListener != nil {
 		n.httpListener.Close()
 	}
@@ -632,6 +843,53 @@ func (n *NSQD) channels() []*Channel {
 	return channels
 }
 
+const depthSampleInterval = time.Second
+
+// depthSampleLoop samples every topic's and channel's depth (for approximate
+// stats and the channel depth moving average) once per depthSampleInterval
+func (n *NSQD) depthSampleLoop() {
+	ticker := time.NewTicker(depthSampleInterval)
+	for {
+		select {
+		case <-n.exitChan:
+			goto exit
+		case <-ticker.C:
+			n.RLock()
+			topics := make([]*Topic, 0, len(n.topicMap))
+			for _, t := range n.topicMap {
+				topics = append(topics, t)
+			}
+			n.RUnlock()
+			for _, t := range topics {
+				t.sampleDepth()
+			}
+			alpha := n.getOpts().DepthEWMAAlpha
+			for _, c := range n.channels() {
+				c.sampleDepth(alpha)
+			}
+		}
+	}
+
+exit:
+	ticker.Stop()
+}
+
+// statsHistoryLoop adds a point to statsHistory every --stats-history-interval
+func (n *NSQD) statsHistoryLoop() {
+	ticker := time.NewTicker(n.getOpts().StatsHistoryInterval)
+	for {
+		select {
+		case <-n.exitChan:
+			goto exit
+		case now := <-ticker.C:
+			n.statsHistory.add(newStatsHistoryPoint(n.GetStats("", ""), now))
+		}
+	}
+
+exit:
+	ticker.Stop()
+}
+
 // resizePool adjusts the size of the pool of queueScanWorker goroutines
 //
 // 	1 <= pool <= min(num * 0.25, QueueScanWorkerPoolMax)
@@ -395,6 +395,19 @@ func TestReconfigure(t *testing.T) {
 	}
 	test.Equal(t, 2, len(lookupPeers))
 	test.Equal(t, newOpts.NSQLookupdTCPAddresses, lookupPeers)
+
+	// nothing is listening on the (reserved) tcpmux port
+	newOpts = *opts
+	newOpts.NSQLookupdTCPAddresses = []string{lookupd2.RealTCPAddr().String(), "127.0.0.1:1"}
+	nsqd.swapOpts(&newOpts)
+	nsqd.triggerOptsNotification()
+
+	time.Sleep(200 * time.Millisecond)
+
+	lookupdStats := nsqd.GetLookupdStats()
+	test.Equal(t, 2, len(lookupdStats))
+	test.Equal(t, LookupdStats{lookupd2.RealTCPAddr().String(), true}, lookupdStats[0])
+	test.Equal(t, LookupdStats{"127.0.0.1:1", false}, lookupdStats[1])
 }
 
 func TestCluster(t *testing.T) {
@@ -520,6 +533,103 @@ func TestSetHealth(t *testing.T) {
 	test.Equal(t, true, nsqd.IsHealthy())
 }
 
+func TestDraining(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	nsqd := New(opts)
+
+	test.Equal(t, false, nsqd.IsDraining())
+	nsqd.Exit()
+	test.Equal(t, true, nsqd.IsDraining())
+}
+
+func TestDrainDuration(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.DrainDuration = 500 * time.Millisecond
+	tcpAddr, httpAddr, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+
+	exited := make(chan struct{})
+	go func() {
+		nsqd.Exit()
+		close(exited)
+	}()
+
+	var d struct {
+		Draining bool `json:"draining"`
+	}
+	endpoint := fmt.Sprintf("http://%s/stats?format=json", httpAddr)
+	for i := 0; i < 100 && !nsqd.IsDraining(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	// /stats is still served, while TCP connections are no longer accepted
+	err := http_api.NewClient(nil, ConnectTimeout, RequestTimeout).GETV1(endpoint, &d)
+	test.Nil(t, err)
+	test.Equal(t, true, d.Draining)
+	for i := 0; i < 100; i++ {
+		var conn net.Conn
+		conn, err = net.DialTimeout("tcp", tcpAddr.String(), time.Second)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		time.Sleep(time.Millisecond)
+	}
+	test.NotNil(t, err)
+
+	<-exited
+}
+
+func TestMetadataPersistStats(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	nsqd.Lock()
+	err := nsqd.PersistMetadata()
+	nsqd.Unlock()
+	test.Nil(t, err)
+	duration, age := nsqd.GetMetadataPersistStats()
+	test.NotEqual(t, int64(0), duration)
+	test.NotEqual(t, int64(0), age)
+}
+
+func TestDegraded(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	nsqd := New(opts)
+	defer nsqd.Exit()
+
+	degraded, reasons := nsqd.GetDegraded()
+	test.Equal(t, false, degraded)
+	test.Equal(t, 0, len(reasons))
+
+	nsqd.SetHealth(errors.New("health error"))
+	degraded, reasons = nsqd.GetDegraded()
+	test.Equal(t, true, degraded)
+	test.Equal(t, []string{"backend error - health error"}, reasons)
+	nsqd.SetHealth(nil)
+
+	newOpts := *opts
+	newOpts.DegradedMaxGoroutines = 1
+	nsqd.swapOpts(&newOpts)
+	degraded, reasons = nsqd.GetDegraded()
+	test.Equal(t, true, degraded)
+	test.Equal(t, 1, len(reasons))
+
+	if _, err := diskFreeBytes("."); err == nil {
+		newOpts := *opts
+		newOpts.DegradedMinFreeBytes = 1 << 62
+		nsqd.swapOpts(&newOpts)
+		degraded, reasons = nsqd.GetDegraded()
+		test.Equal(t, true, degraded)
+		test.Equal(t, 1, len(reasons))
+	}
+}
+
 func TestCrashingLogger(t *testing.T) {
 	if os.Getenv("BE_CRASHER") == "1" {
 		// Test invalid log level causes error
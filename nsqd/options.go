@@ -29,6 +29,7 @@ type Options struct {
 	AuthHTTPAddresses        []string      `flag:"auth-http-address" cfg:"auth_http_addresses"`
 	HTTPClientConnectTimeout time.Duration `flag:"http-client-connect-timeout" cfg:"http_client_connect_timeout"`
 	HTTPClientRequestTimeout time.Duration `flag:"http-client-request-timeout" cfg:"http_client_request_timeout"`
+	DrainDuration            time.Duration `flag:"drain-duration"`
 
 	// diskqueue options
 	DataPath        string        `flag:"data-path"`
@@ -49,6 +50,7 @@ type Options struct {
 	MaxMsgSize    int64         `flag:"max-msg-size"`
 	MaxBodySize   int64         `flag:"max-body-size"`
 	MaxReqTimeout time.Duration `flag:"max-req-timeout"`
+	MaxAttempts   int64         `flag:"max-attempts"`
 	ClientTimeout time.Duration
 
 	// client overridable configuration options
@@ -57,6 +59,37 @@ type Options struct {
 	MaxOutputBufferSize    int64         `flag:"max-output-buffer-size"`
 	MaxOutputBufferTimeout time.Duration `flag:"max-output-buffer-timeout"`
 
+	// degraded thresholds
+	DegradedMinFreeBytes  int64 `flag:"degraded-min-free-bytes"`
+	DegradedMaxGoroutines int   `flag:"degraded-max-goroutines"`
+
+	// nsqd HTTP addresses merged by /stats/cluster
+	StatsClusterNodes []string `flag:"stats-cluster-node" cfg:"stats_cluster_nodes"`
+
+	// period over which channel min/max client counts are tracked
+	ClientCountWindow time.Duration `flag:"client-count-window"`
+
+	// smoothing factor applied to channel depth every second
+	DepthEWMAAlpha float64 `flag:"depth-ewma-alpha"`
+
+	// stats snapshots kept for /stats/history
+	StatsHistorySize     int           `flag:"stats-history-size"`
+	StatsHistoryInterval time.Duration `flag:"stats-history-interval"`
+
+	// topics without messages for this long are reported as quiet
+	QuietTopicThreshold time.Duration `flag:"quiet-topic-threshold"`
+
+	// weights of the components of the client QualityScore
+	QualityScoreIdleWeight        float64 `flag:"quality-score-idle-weight"`
+	QualityScoreWriteErrorWeight  float64 `flag:"quality-score-write-error-weight"`
+	QualityScoreRdyWeight         float64 `flag:"quality-score-rdy-weight"`
+	QualityScoreNearTimeoutWeight float64 `flag:"quality-score-near-timeout-weight"`
+
+	// thresholds (0 to disable) for /stats/alerts
+	AlertDepthThreshold       int64         `flag:"alert-depth-threshold"`
+	AlertAgeThreshold         time.Duration `flag:"alert-age-threshold"`
+	AlertTimeoutRateThreshold float64       `flag:"alert-timeout-rate-threshold"`
+
 	// statsd integration
 	StatsdAddress  string        `flag:"statsd-address"`
 	StatsdPrefix   string        `flag:"statsd-prefix"`
@@ -67,6 +100,19 @@ type Options struct {
 	E2EProcessingLatencyWindowTime  time.Duration `flag:"e2e-processing-latency-window-time"`
 	E2EProcessingLatencyPercentiles []float64     `flag:"e2e-processing-latency-percentile" cfg:"e2e_processing_latency_percentiles"`
 
+	// channel dwell time (enqueue to finish), with the e2e percentiles/window
+	DwellTimeEnabled bool `flag:"dwell-time"`
+
+	// channel dispatch latency (deliverable to sent to a client), with the e2e
+	// percentiles/window
+	DispatchLatencyEnabled bool `flag:"dispatch-latency"`
+
+	// per-client ack latency (sent to FIN), with the e2e percentiles/window
+	AckLatencyEnabled bool `flag:"ack-latency"`
+
+	// significant digits of quantile values in /stats output (0 = unrounded)
+	StatsQuantileDigits int `flag:"stats-quantile-digits"`
+
 	// TLS config
 	TLSCert             string `flag:"tls-cert"`
 	TLSKey              string `flag:"tls-key"`
@@ -130,6 +176,19 @@ func NewOptions() *Options {
 		MaxOutputBufferSize:    64 * 1024,
 		MaxOutputBufferTimeout: 1 * time.Second,
 
+		StatsClusterNodes: make([]string, 0),
+		ClientCountWindow: 5 * time.Minute,
+		DepthEWMAAlpha:    0.1,
+
+		StatsHistoryInterval: 5 * time.Second,
+
+		QuietTopicThreshold: 5 * time.Minute,
+
+		QualityScoreIdleWeight:        1,
+		QualityScoreWriteErrorWeight:  1,
+		QualityScoreRdyWeight:         1,
+		QualityScoreNearTimeoutWeight: 1,
+
 		StatsdPrefix:   "nsq.%s",
 		StatsdInterval: 60 * time.Second,
 		StatsdMemStats: true,
@@ -0,0 +1,11 @@
+// +build !linux
+
+package nsqd
+
+import (
+	"errors"
+)
+
+func processRSSBytes() (int64, error) {
+	return 0, errors.New("not supported on this platform")
+}
@@ -40,6 +40,7 @@ func (p *protocolV2) IOLoop(conn net.Conn) error {
 
 	clientID := atomic.AddInt64(&p.ctx.nsqd.clientIDSequence, 1)
 	client := newClientV2(clientID, conn, p.ctx)
+	p.ctx.nsqd.moveClientVersion("", client.version())
 
 	// synchronize the startup of messagePump in order
 	// to guarantee that it gets a chance to initialize
@@ -76,6 +77,7 @@ func (p *protocolV2) IOLoop(conn net.Conn) error {
 			line = line[:len(line)-1]
 		}
 		params := bytes.Split(line, separatorBytes)
+		client.recordCommand(params[0])
 
 		p.ctx.nsqd.logf(LOG_DEBUG, "PROTOCOL(V2): [%s] %s", client, params)
 
@@ -113,7 +115,11 @@ func (p *protocolV2) IOLoop(conn net.Conn) error {
 	p.ctx.nsqd.logf(LOG_INFO, "PROTOCOL(V2): [%s] exiting ioloop", client)
 	conn.Close()
 	close(client.ExitChan)
+	p.ctx.nsqd.moveClientVersion(client.version(), "")
 	if client.Channel != nil {
+		if err != nil || atomic.LoadUint64(&client.writeErrorCount) > 0 {
+			atomic.AddUint64(&client.Channel.abnormalDisconnectCount, 1)
+		}
 		client.Channel.RemoveClient(client.ID)
 	}
 
@@ -147,12 +153,19 @@ func (p *protocolV2) Send(client *clientV2, frameType int32, data []byte) error
 		client.SetWriteDeadline(zeroTime)
 	}
 
+	prevBuffered := client.Writer.Buffered()
 	_, err := protocol.SendFramedResponse(client.Writer, frameType, data)
 	if err != nil {
+		atomic.AddUint64(&client.writeErrorCount, 1)
 		client.writeLock.Unlock()
 		return err
 	}
 
+	if frameType == frameTypeMessage {
+		// size + frame type + data
+		client.recordBuffered(prevBuffered, 8+len(data))
+	}
+
 	if frameType != frameTypeMessage {
 		err = client.Flush()
 	}
@@ -294,6 +307,7 @@ func (p *protocolV2) messagePump(client *clientV2, startedChan chan bool) {
 
 			msgTimeout = identifyData.MsgTimeout
 		case <-heartbeatChan:
+			client.recordHeartbeat(time.Now())
 			err = p.Send(client, frameTypeResponse, heartbeatBytes)
 			if err != nil {
 				goto exit
@@ -305,10 +319,15 @@ func (p *protocolV2) messagePump(client *clientV2, startedChan chan bool) {
 
 			msg, err := decodeMessage(b)
 			if err != nil {
+				subChannel.lastError.set(err)
 				p.ctx.nsqd.logf(LOG_ERROR, "failed to decode message - %s", err)
 				continue
 			}
 			msg.Attempts++
+			if subChannel.exceedsMaxAttempts(msg) {
+				continue
+			}
+			atomic.AddUint64(&subChannel.backendDeliveredCount, 1)
 
 			subChannel.StartInFlightTimeout(msg, client.ID, msgTimeout)
 			client.SendingMessage()
@@ -318,10 +337,15 @@ func (p *protocolV2) messagePump(client *clientV2, startedChan chan bool) {
 			}
 			flushed = false
 		case msg := <-memoryMsgChan:
+			atomic.AddInt64(&subChannel.memoryBytes, -messageSize(msg))
 			if sampleRate > 0 && rand.Int31n(100) > sampleRate {
 				continue
 			}
 			msg.Attempts++
+			if subChannel.exceedsMaxAttempts(msg) {
+				continue
+			}
+			atomic.AddUint64(&subChannel.inMemoryDeliveredCount, 1)
 
 			subChannel.StartInFlightTimeout(msg, client.ID, msgTimeout)
 			client.SendingMessage()
@@ -381,7 +405,9 @@ func (p *protocolV2) IDENTIFY(client *clientV2, params [][]byte) ([]byte, error)
 
 	p.ctx.nsqd.logf(LOG_DEBUG, "PROTOCOL(V2): [%s] %+v", client, identifyData)
 
+	clientVersion := client.version()
 	err = client.Identify(identifyData)
+	p.ctx.nsqd.moveClientVersion(clientVersion, client.version())
 	if err != nil {
 		return nil, protocol.NewFatalClientErr(err, "E_BAD_BODY", "IDENTIFY "+err.Error())
 	}
@@ -402,6 +428,11 @@ func (p *protocolV2) IDENTIFY(client *clientV2, params [][]byte) ([]byte, error)
 	}
 	snappy := p.ctx.nsqd.getOpts().SnappyEnabled && identifyData.Snappy
 
+	// compression that was asked for but is disabled, or both at once
+	if identifyData.Deflate != deflate || identifyData.Snappy != snappy || (deflate && snappy) {
+		atomic.AddUint64(&p.ctx.nsqd.compressionNegotiationFailureCount, 1)
+	}
+
 	if deflate && snappy {
 		return nil, protocol.NewFatalClientErr(nil, "E_IDENTIFY_FAILED", "cannot enable both deflate and snappy compression")
 	}
@@ -610,9 +641,11 @@ func (p *protocolV2) SUB(client *clientV2, params [][]byte) ([]byte, error) {
 	// This retry-loop is a work-around for a race condition, where the
 	// last client can leave the channel between GetChannel() and AddClient().
 	// Avoid adding a client to an ephemeral channel / topic which has started exiting.
+	var topic *Topic
 	var channel *Channel
+	atomic.AddInt64(&p.ctx.nsqd.blockedSubCount, 1)
 	for {
-		topic := p.ctx.nsqd.GetTopic(topicName)
+		topic = p.ctx.nsqd.GetTopic(topicName)
 		channel = topic.GetChannel(channelName)
 		channel.AddClient(client.ID, client)
 
@@ -623,8 +656,13 @@ func (p *protocolV2) SUB(client *clientV2, params [][]byte) ([]byte, error) {
 		}
 		break
 	}
+	atomic.AddInt64(&p.ctx.nsqd.blockedSubCount, -1)
+	topic.recordConsumer()
 	atomic.StoreInt32(&client.State, stateSubscribed)
+	// Channel is read (by Stats) from other goroutines
+	client.metaLock.Lock()
 	client.Channel = channel
+	client.metaLock.Unlock()
 	// update message pump
 	client.SubEventChan <- channel
 
@@ -656,6 +694,9 @@ func (p *protocolV2) RDY(client *clientV2, params [][]byte) ([]byte, error) {
 		count = int64(b10)
 	}
 
+	if count > p.ctx.nsqd.getOpts().MaxRdyCount {
+		atomic.AddUint64(&client.Channel.rdyRejectedCount, 1)
+	}
 	if count < 0 || count > p.ctx.nsqd.getOpts().MaxRdyCount {
 		// this needs to be a fatal error otherwise clients would have
 		// inconsistent state
@@ -663,6 +704,12 @@ func (p *protocolV2) RDY(client *clientV2, params [][]byte) ([]byte, error) {
 			fmt.Sprintf("RDY count %d out of range 0-%d", count, p.ctx.nsqd.getOpts().MaxRdyCount))
 	}
 
+	// only a change to the RDY the client has already set counts, not its
+	// first one after SUB (nor a repeat of the same count)
+	if client.readyCountSet && atomic.LoadInt64(&client.ReadyCount) != count {
+		atomic.AddUint64(&client.Channel.rdyChangeCount, 1)
+	}
+	client.readyCountSet = true
 	client.SetReadyCount(count)
 
 	return nil, nil
@@ -683,12 +730,15 @@ func (p *protocolV2) FIN(client *clientV2, params [][]byte) ([]byte, error) {
 		return nil, protocol.NewFatalClientErr(nil, "E_INVALID", err.Error())
 	}
 
-	err = client.Channel.FinishMessage(client.ID, *id)
+	msg, err := client.Channel.finishMessage(client.ID, *id)
 	if err != nil {
 		return nil, protocol.NewClientErr(err, "E_FIN_FAILED",
 			fmt.Sprintf("FIN %s failed %s", *id, err.Error()))
 	}
 
+	if client.ackLatencyStream != nil {
+		client.ackLatencyStream.Insert(msg.deliveryTS.UnixNano())
+	}
 	client.FinishedMessage()
 
 	return nil, nil
@@ -723,6 +773,7 @@ func (p *protocolV2) REQ(client *clientV2, params [][]byte) ([]byte, error) {
 		clampedTimeout = 0
 	} else if timeoutDuration > maxReqTimeout {
 		clampedTimeout = maxReqTimeout
+		atomic.AddUint64(&client.Channel.deferredClampedCount, 1)
 	}
 	if clampedTimeout != timeoutDuration {
 		p.ctx.nsqd.logf(LOG_INFO, "PROTOCOL(V2): [%s] REQ timeout %d out of range 0-%d. Setting to %d",
@@ -799,6 +850,8 @@ func (p *protocolV2) PUB(client *clientV2, params [][]byte) ([]byte, error) {
 	if err != nil {
 		return nil, protocol.NewFatalClientErr(err, "E_PUB_FAILED", "PUB failed "+err.Error())
 	}
+	atomic.AddUint64(&topic.tcpPublishCount, 1)
+	atomic.AddUint64(&topic.pubCommandCount, 1)
 
 	return okBytes, nil
 }
@@ -850,6 +903,8 @@ func (p *protocolV2) MPUB(client *clientV2, params [][]byte) ([]byte, error) {
 	if err != nil {
 		return nil, protocol.NewFatalClientErr(err, "E_MPUB_FAILED", "MPUB failed "+err.Error())
 	}
+	atomic.AddUint64(&topic.tcpPublishCount, uint64(len(messages)))
+	atomic.AddUint64(&topic.mpubCommandCount, 1)
 
 	return okBytes, nil
 }
@@ -912,6 +967,8 @@ func (p *protocolV2) DPUB(client *clientV2, params [][]byte) ([]byte, error) {
 	if err != nil {
 		return nil, protocol.NewFatalClientErr(err, "E_DPUB_FAILED", "DPUB failed "+err.Error())
 	}
+	atomic.AddUint64(&topic.tcpPublishCount, 1)
+	atomic.AddUint64(&topic.dpubCommandCount, 1)
 
 	return okBytes, nil
 }
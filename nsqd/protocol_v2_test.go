@@ -275,6 +275,34 @@ func TestClientHeartbeat(t *testing.T) {
 	test.Nil(t, err)
 }
 
+func TestBlockedSubCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	tcpAddr, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_blocked_sub_count" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+
+	conn, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	defer conn.Close()
+
+	// creating the channel needs the topic lock
+	topic.Lock()
+	_, err = nsq.Subscribe(topicName, "ch").WriteTo(conn)
+	test.Nil(t, err)
+	for i := 0; i < 100 && nsqd.GetBlockedSubCount() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.Equal(t, 1, nsqd.GetBlockedSubCount())
+	topic.Unlock()
+
+	readValidate(t, conn, frameTypeResponse, "OK")
+	test.Equal(t, 0, nsqd.GetBlockedSubCount())
+}
+
 func TestClientHeartbeatDisableSUB(t *testing.T) {
 	topicName := "test_hb_v2" + strconv.Itoa(int(time.Now().Unix()))
 
@@ -553,6 +581,12 @@ func TestSizeLimits(t *testing.T) {
 	t.Logf("frameType: %d, data: %s", frameType, data)
 	test.Equal(t, frameTypeError, frameType)
 	test.Equal(t, fmt.Sprintf("E_BAD_MESSAGE MPUB message too big 101 > 100"), string(data))
+
+	// only the valid PUB and MPUB (of 5) were published
+	stats := NewTopicStats(nsqd.GetTopic(topicName), nil, false)
+	test.Equal(t, uint64(6), stats.TCPPublishCount)
+	test.Equal(t, uint64(0), stats.HTTPPublishCount)
+	test.Equal(t, map[string]uint64{"PUB": 1, "MPUB": 1, "DPUB": 0}, stats.PubCommandCounts)
 }
 
 func TestDPUB(t *testing.T) {
@@ -596,6 +630,9 @@ func TestDPUB(t *testing.T) {
 	t.Logf("frameType: %d, data: %s", frameType, data)
 	test.Equal(t, frameTypeError, frameType)
 	test.Equal(t, fmt.Sprintf("E_INVALID DPUB timeout 3600100 out of range 0-3600000"), string(data))
+
+	stats := NewTopicStats(nsqd.GetTopic(topicName), nil, false)
+	test.Equal(t, uint64(1), stats.PubCommandCounts["DPUB"])
 }
 
 func TestTouch(t *testing.T) {
@@ -644,6 +681,251 @@ func TestTouch(t *testing.T) {
 	test.Equal(t, uint64(0), channel.timeoutCount)
 }
 
+func TestClientAckLatency(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.E2EProcessingLatencyPercentiles = []float64{1.0}
+	opts.AckLatencyEnabled = true
+	tcpAddr, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_client_ack_latency" + strconv.Itoa(int(time.Now().Unix()))
+
+	conn, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	defer conn.Close()
+
+	identify(t, conn, nil, frameTypeResponse)
+	sub(t, conn, topicName, "ch")
+
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("ch")
+	msg := NewMessage(topic.GenerateID(), []byte("test body"))
+	topic.PutMessage(msg)
+
+	_, err = nsq.Ready(1).WriteTo(conn)
+	test.Nil(t, err)
+
+	resp, err := nsq.ReadResponse(conn)
+	test.Nil(t, err)
+	frameType, data, err := nsq.UnpackResponse(resp)
+	msgOut, _ := decodeMessage(data)
+	test.Equal(t, frameTypeMessage, frameType)
+	test.Equal(t, msg.ID, msgOut.ID)
+
+	time.Sleep(10 * time.Millisecond)
+	_, err = nsq.Finish(nsq.MessageID(msg.ID)).WriteTo(conn)
+	test.Nil(t, err)
+
+	// FIN has no response, so poll until it has been processed
+	clientStats := func() ClientStats {
+		channel.RLock()
+		defer channel.RUnlock()
+		for _, client := range channel.clients {
+			return client.Stats()
+		}
+		return ClientStats{}
+	}
+	for i := 0; i < 100 && clientStats().FinishCount < 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	ackLatency := clientStats().AckLatency
+	test.Equal(t, 1, ackLatency.Count)
+	if ackLatency.Percentiles[0]["value"] < float64(10*time.Millisecond) {
+		t.Fatalf("ack latency %v less than time before FIN", ackLatency.Percentiles[0]["value"])
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.LogLevel = "debug"
+	opts.MaxAttempts = 1
+	tcpAddr, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_max_attempts" + strconv.Itoa(int(time.Now().Unix()))
+
+	conn, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	defer conn.Close()
+
+	identify(t, conn, nil, frameTypeResponse)
+	sub(t, conn, topicName, "ch")
+
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("ch")
+	msg := NewMessage(topic.GenerateID(), []byte("test body"))
+	topic.PutMessage(msg)
+
+	_, err = nsq.Ready(1).WriteTo(conn)
+	test.Nil(t, err)
+
+	resp, err := nsq.ReadResponse(conn)
+	test.Nil(t, err)
+	frameType, data, err := nsq.UnpackResponse(resp)
+	msgOut, _ := decodeMessage(data)
+	test.Equal(t, frameTypeMessage, frameType)
+	test.Equal(t, msg.ID, msgOut.ID)
+	test.Equal(t, uint16(1), msgOut.Attempts)
+
+	_, err = nsq.Requeue(nsq.MessageID(msg.ID), 0).WriteTo(conn)
+	test.Nil(t, err)
+
+	// the requeued message is discarded rather than attempted a second time
+	time.Sleep(50 * time.Millisecond)
+
+	stats := nsqd.GetStats(topicName, "ch")
+	test.Equal(t, uint64(1), stats[0].Channels[0].MaxAttemptsExceededCount)
+	test.Equal(t, uint64(0), stats[0].Channels[0].InFlightCount)
+	test.Equal(t, int64(0), channel.Depth())
+}
+
+func TestDeliveredCounts(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.LogLevel = "debug"
+	opts.MemQueueSize = 0
+	tcpAddr, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_delivered_counts" + strconv.Itoa(int(time.Now().Unix()))
+
+	conn, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	defer conn.Close()
+
+	identify(t, conn, nil, frameTypeResponse)
+	sub(t, conn, topicName, "ch")
+
+	// with no RDY (and no memory queue) the message has to go to the backend
+	channel := nsqd.GetTopic(topicName).GetChannel("ch")
+	msg := NewMessage(nsqd.GetTopic(topicName).GenerateID(), []byte("test body"))
+	channel.PutMessage(msg)
+	test.Equal(t, int64(1), channel.backend.Depth())
+
+	_, err = nsq.Ready(1).WriteTo(conn)
+	test.Nil(t, err)
+
+	resp, err := nsq.ReadResponse(conn)
+	test.Nil(t, err)
+	frameType, data, err := nsq.UnpackResponse(resp)
+	msgOut, _ := decodeMessage(data)
+	test.Equal(t, frameTypeMessage, frameType)
+	test.Equal(t, msg.ID, msgOut.ID)
+
+	stats := nsqd.GetStats(topicName, "ch")
+	test.Equal(t, uint64(1), stats[0].Channels[0].BackendDeliveredCount)
+	test.Equal(t, uint64(0), stats[0].Channels[0].InMemoryDeliveredCount)
+}
+
+func TestAbnormalDisconnectCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.LogLevel = "debug"
+	tcpAddr, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_abnormal_disconnect_count" + strconv.Itoa(int(time.Now().Unix()))
+	channel := nsqd.GetTopic(topicName).GetChannel("ch")
+	waitForNoClients := func() {
+		for i := 0; i < 100; i++ {
+			channel.RLock()
+			n := len(channel.clients)
+			channel.RUnlock()
+			if n == 0 {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("client was not removed from channel")
+	}
+
+	// closing the connection is a clean disconnect
+	conn, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	identify(t, conn, nil, frameTypeResponse)
+	sub(t, conn, topicName, "ch")
+	conn.Close()
+	waitForNoClients()
+	test.Equal(t, uint64(0), atomic.LoadUint64(&channel.abnormalDisconnectCount))
+
+	// a fatal protocol error is not
+	conn, err = mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	defer conn.Close()
+	identify(t, conn, nil, frameTypeResponse)
+	sub(t, conn, topicName, "ch")
+	_, err = conn.Write([]byte("INVALID\n"))
+	test.Nil(t, err)
+	readValidate(t, conn, frameTypeError, "E_INVALID invalid command INVALID")
+	waitForNoClients()
+	test.Equal(t, uint64(1), nsqd.GetStats(topicName, "ch")[0].Channels[0].AbnormalDisconnectCount)
+}
+
+func TestClientCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.LogLevel = "debug"
+	tcpAddr, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	conn, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	defer conn.Close()
+	identify(t, conn, nil, frameTypeResponse)
+
+	// counted whether or not they IDENTIFY or SUB
+	conn2, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	defer conn2.Close()
+
+	time.Sleep(25 * time.Millisecond)
+	test.Equal(t, 2, nsqd.GetClientCount())
+	test.Equal(t, 4, nsqd.GetClientGoroutines())
+	test.Equal(t, uint64(2), nsqd.GetAcceptedConnectionCount())
+
+	conn.Close()
+	conn2.Close()
+	time.Sleep(25 * time.Millisecond)
+	test.Equal(t, 0, nsqd.GetClientCount())
+	test.Equal(t, 0, nsqd.GetClientGoroutines())
+}
+
+func TestRdyChangeCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	tcpAddr, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_rdy_change_count" + strconv.Itoa(int(time.Now().Unix()))
+
+	conn, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	defer conn.Close()
+
+	identify(t, conn, nil, frameTypeResponse)
+	sub(t, conn, topicName, "ch")
+
+	// the first RDY, a repeat of it, then two changes
+	for _, rdy := range []int{5, 5, 1, 0} {
+		_, err = nsq.Ready(rdy).WriteTo(conn)
+		test.Nil(t, err)
+	}
+	// RDY has no response, so poll until they have been processed
+	channel := nsqd.GetTopic(topicName).GetChannel("ch")
+	for i := 0; i < 100 && NewChannelStats(channel, nil, false).RdyChangeCount < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.Equal(t, uint64(2), NewChannelStats(channel, nil, false).RdyChangeCount)
+}
+
 func TestMaxRdyCount(t *testing.T) {
 	opts := NewOptions()
 	opts.Logger = test.NewTestLogger(t)
@@ -692,6 +974,35 @@ func TestMaxRdyCount(t *testing.T) {
 	test.Equal(t, "E_INVALID RDY count 51 out of range 0-50", string(data))
 }
 
+func TestRdyRejectedCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.MaxRdyCount = 50
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	defer conn.Close()
+
+	topicName := "test_rdy_rejected_count" + strconv.Itoa(int(time.Now().Unix()))
+	channel := nsqd.GetTopic(topicName).GetChannel("ch")
+
+	p := &protocolV2{ctx: &context{nsqd}}
+	client := newClientV2(0, conn, &context{nsqd})
+	client.Channel = channel
+	atomic.StoreInt32(&client.State, stateSubscribed)
+
+	_, err := p.RDY(client, [][]byte{[]byte("RDY"), []byte("50")})
+	test.Nil(t, err)
+	test.Equal(t, uint64(0), NewChannelStats(channel, nil, false).RdyRejectedCount)
+
+	_, err = p.RDY(client, [][]byte{[]byte("RDY"), []byte("51")})
+	test.NotNil(t, err)
+	test.Equal(t, uint64(1), NewChannelStats(channel, nil, false).RdyRejectedCount)
+}
+
 func TestFatalError(t *testing.T) {
 	opts := NewOptions()
 	opts.Logger = test.NewTestLogger(t)
@@ -850,6 +1161,34 @@ func TestTLS(t *testing.T) {
 	test.Equal(t, []byte("OK"), data)
 }
 
+func TestTLSHandshakeFailureCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.LogLevel = "debug"
+	opts.TLSCert = "./test/certs/server.pem"
+	opts.TLSKey = "./test/certs/server.key"
+	tcpAddr, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	conn, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	defer conn.Close()
+
+	identify(t, conn, map[string]interface{}{
+		"tls_v1": true,
+	}, frameTypeResponse)
+
+	// not a TLS client hello
+	_, err = conn.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	test.Nil(t, err)
+
+	for i := 0; i < 100 && nsqd.GetTLSHandshakeFailureCount() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.Equal(t, uint64(1), nsqd.GetTLSHandshakeFailureCount())
+}
+
 func TestTLSRequired(t *testing.T) {
 	opts := NewOptions()
 	opts.Logger = test.NewTestLogger(t)
@@ -1085,6 +1424,65 @@ func TestDeflate(t *testing.T) {
 	test.Equal(t, []byte("OK"), data)
 }
 
+func TestCompressionNegotiationFailureCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.LogLevel = "debug"
+	opts.DeflateEnabled = false
+	tcpAddr, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	conn, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	defer conn.Close()
+
+	data := identify(t, conn, map[string]interface{}{
+		"deflate": true,
+	}, frameTypeResponse)
+	r := struct {
+		Deflate bool `json:"deflate"`
+	}{}
+	err = json.Unmarshal(data, &r)
+	test.Nil(t, err)
+	test.Equal(t, false, r.Deflate)
+	test.Equal(t, uint64(1), nsqd.GetCompressionNegotiationFailureCount())
+
+	conn2, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	defer conn2.Close()
+
+	identify(t, conn2, map[string]interface{}{
+		"snappy": true,
+	}, frameTypeResponse)
+	test.Equal(t, uint64(1), nsqd.GetCompressionNegotiationFailureCount())
+}
+
+func TestDeflateCompressionRatio(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	go io.Copy(ioutil.Discard, clientConn)
+
+	client := newClientV2(0, serverConn, &context{nsqd})
+	test.Equal(t, float64(0), client.Stats().CompressionRatio)
+
+	err := client.UpgradeDeflate(6)
+	test.Nil(t, err)
+	client.Writer.Write(bytes.Repeat([]byte("a"), 4096))
+	err = client.Flush()
+	test.Nil(t, err)
+
+	ratio := client.Stats().CompressionRatio
+	t.Logf("compression ratio: %f", ratio)
+	test.Equal(t, true, ratio > 10)
+}
+
 type readWriter struct {
 	io.Reader
 	io.Writer
@@ -1461,6 +1859,9 @@ func TestReqTimeoutRange(t *testing.T) {
 
 	test.NotNil(t, pqItem)
 	test.Equal(t, true, pqItem.Priority >= minTs)
+
+	// only the REQ over --max-req-timeout was clamped to it
+	test.Equal(t, uint64(1), NewChannelStats(channel, nil, false).DeferredClampedCount)
 }
 
 func TestClientAuth(t *testing.T) {
@@ -0,0 +1,75 @@
+package nsqd
+
+import (
+	"sync"
+	"time"
+)
+
+// rateTrendSamples is how many samples of a counter rateTrend keeps, at the
+// depthSampleInterval this is a one minute window
+const rateTrendSamples = 60
+
+// rateTrend keeps the last rateTrendSamples values of a (cumulative) counter,
+// sampled at a fixed interval, and reports whether its rate is rising or
+// falling
+type rateTrend struct {
+	sync.Mutex
+	samples [rateTrendSamples]uint64
+	next    int
+	count   int
+}
+
+func (r *rateTrend) add(v uint64) {
+	r.Lock()
+	r.samples[r.next] = v
+	r.next = (r.next + 1) % rateTrendSamples
+	if r.count < rateTrendSamples {
+		r.count++
+	}
+	r.Unlock()
+}
+
+// slope returns the least squares slope of the per-second rate between
+// consecutive samples (taken interval apart), ie. the change in rate per
+// second. It is zero until there are at least three samples.
+func (r *rateTrend) slope(interval time.Duration) float64 {
+	r.Lock()
+	defer r.Unlock()
+	n := r.count - 1
+	if n < 2 {
+		return 0
+	}
+	start := r.next - r.count + rateTrendSamples
+	seconds := interval.Seconds()
+	rates := make([]float64, n)
+	var meanX, meanRate float64
+	for i := range rates {
+		prev := r.samples[(start+i)%rateTrendSamples]
+		cur := r.samples[(start+i+1)%rateTrendSamples]
+		rates[i] = float64(cur-prev) / seconds
+		meanX += float64(i) * seconds
+		meanRate += rates[i]
+	}
+	meanX /= float64(n)
+	meanRate /= float64(n)
+	var cov, varX float64
+	for i, rate := range rates {
+		dx := float64(i)*seconds - meanX
+		cov += dx * (rate - meanRate)
+		varX += dx * dx
+	}
+	return cov / varX
+}
+
+// rate returns the average per-second rate across the kept samples (taken
+// interval apart), zero until there are at least two
+func (r *rateTrend) rate(interval time.Duration) float64 {
+	r.Lock()
+	defer r.Unlock()
+	if r.count < 2 {
+		return 0
+	}
+	oldest := r.samples[(r.next-r.count+rateTrendSamples)%rateTrendSamples]
+	newest := r.samples[(r.next-1+rateTrendSamples)%rateTrendSamples]
+	return float64(newest-oldest) / (float64(r.count-1) * interval.Seconds())
+}
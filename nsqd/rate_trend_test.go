@@ -0,0 +1,52 @@
+package nsqd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nsqio/nsq/internal/test"
+)
+
+func TestRateTrend(t *testing.T) {
+	var r rateTrend
+	test.Equal(t, float64(0), r.slope(time.Second))
+
+	// a steady rate has no trend
+	for i := uint64(0); i < 10; i++ {
+		r.add(i * 5)
+	}
+	test.Equal(t, float64(0), r.slope(time.Second))
+
+	// rates of 0, 1, 2, ... rise by 1/s every second
+	r = rateTrend{}
+	var total uint64
+	for i := uint64(0); i < rateTrendSamples+10; i++ {
+		total += i
+		r.add(total)
+	}
+	test.Equal(t, float64(1), r.slope(time.Second))
+	test.Equal(t, 0.25, r.slope(2*time.Second))
+
+	// and falling
+	r = rateTrend{}
+	total = 0
+	for i := uint64(10); i > 0; i-- {
+		total += i
+		r.add(total)
+	}
+	test.Equal(t, float64(-1), r.slope(time.Second))
+}
+
+func TestRateTrendRate(t *testing.T) {
+	var r rateTrend
+	test.Equal(t, float64(0), r.rate(time.Second))
+	r.add(7)
+	test.Equal(t, float64(0), r.rate(time.Second))
+
+	// only the last rateTrendSamples count
+	for i := uint64(0); i < rateTrendSamples+10; i++ {
+		r.add(1000 + i*5)
+	}
+	test.Equal(t, float64(5), r.rate(time.Second))
+	test.Equal(t, 2.5, r.rate(2*time.Second))
+}
@@ -1,90 +1,541 @@
 package nsqd
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"math"
+	"net"
+	"reflect"
 	"runtime"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/nsqio/nsq/internal/clusterinfo"
 	"github.com/nsqio/nsq/internal/quantile"
 )
 
 type TopicStats struct {
-	TopicName    string         `json:"topic_name"`
-	Channels     []ChannelStats `json:"channels"`
-	Depth        int64          `json:"depth"`
-	BackendDepth int64          `json:"backend_depth"`
-	MessageCount uint64         `json:"message_count"`
-	Paused       bool           `json:"paused"`
+	TopicName        string `json:"topic_name"`
+	TopicNameEncoded string `json:"topic_name_encoded,omitempty"`
+
+	Channels       []ChannelStats `json:"channels"`
+	Depth          int64          `json:"depth"`
+	BackendDepth   int64          `json:"backend_depth"`
+	MessageCount   uint64         `json:"message_count"`
+	Paused         bool           `json:"paused"`
+	PausedAt       int64          `json:"paused_at"`
+	PausedDuration int64          `json:"paused_duration"`
+	SyncEvery      int64          `json:"sync_every"`
+	SyncTimeout    int64          `json:"sync_timeout"`
+
+	// size (see messageSize) of the messages held in memory, the size of
+	// those in the backend is not known so this is not the total depth size
+	MemoryDepthBytes int64 `json:"memory_depth_bytes"`
+
+	HasBackend bool `json:"has_backend"`
+
+	MemQueueFullCount   uint64 `json:"mem_queue_full_count"`
+	AvgMessageSizeBytes int64  `json:"avg_message_size_bytes"`
+	MaxMessageSizeBytes int64  `json:"max_message_size_bytes"`
+
+	ByteRate float64 `json:"byte_rate"`
+
+	FanoutRatio float64 `json:"fanout_ratio"`
+
+	MPubBatchSize BatchSizeStats `json:"mpub_batch_size"`
+
+	FirstConsumerDelay int64 `json:"first_consumer_delay"`
+
+	LastMessageTimestamp int64 `json:"last_message_ts"`
+	Quiet                bool  `json:"quiet"`
+
+	DeferredPublishCount       uint64 `json:"deferred_publish_count"`
+	MaxDeferredPublishDuration int64  `json:"max_deferred_publish_duration"`
+	PublishedWhilePausedCount  uint64 `json:"published_while_paused_count"`
+
+	HTTPPublishCount uint64 `json:"http_publish_count"`
+	TCPPublishCount  uint64 `json:"tcp_publish_count"`
+
+	// successful TCP publish commands, by command (PUB, MPUB and DPUB)
+	PubCommandCounts map[string]uint64 `json:"pub_command_counts"`
+
+	TotalChannelsCreated uint64 `json:"total_channels_created"`
+	UniqueClientHosts    int    `json:"unique_client_hosts"`
+	OrphanChannelCount   int    `json:"orphan_channel_count"`
+	BackedUpChannelCount int    `json:"backed_up_channel_count"`
+
+	E2eProcessingLatencyWindow     int64 `json:"e2e_processing_latency_window"`
+	E2eProcessingLatencySubWindows int   `json:"e2e_processing_latency_sub_windows"`
+
+	LastError          string `json:"last_error"`
+	LastErrorTimestamp int64  `json:"last_error_ts"`
 
 	E2eProcessingLatency *quantile.Result `json:"e2e_processing_latency"`
 }
 
-func NewTopicStats(t *Topic, channels []ChannelStats) TopicStats {
+// NewTopicStats returns the stats for t, when approximate the depths are the
+// ones last sampled by depthSampleLoop rather than read from the backend
+func NewTopicStats(t *Topic, channels []ChannelStats, approximate bool) TopicStats {
+	depth, backendDepth := t.depths(approximate)
+	syncEvery, syncTimeout := backendSyncStats(t.backend, t.ctx.nsqd.getOpts())
+	pausedAt, pausedDuration := pausedStats(atomic.LoadInt64(&t.pausedAt))
+	// while no client has ever subscribed this is how long the topic has been
+	// waiting for one
+	var firstConsumerDelay int64
+	if atomic.LoadInt64(&t.firstConsumerAt) == 0 {
+		firstConsumerDelay = int64(time.Since(t.createdAt).Seconds())
+	}
+	e2eWindowTime, e2eSubWindows := t.E2eProcessingLatencyWindow()
+	lastErr, lastErrAt := t.lastError.get()
+	var hosts map[string]struct{}
+	var backedUpChannelCount int
+	for _, c := range channels {
+		hosts = clientHosts(c.Clients, hosts)
+		if c.Depth > 0 {
+			backedUpChannelCount++
+		}
+	}
+	messageCount := atomic.LoadUint64(&t.messageCount)
+	var avgMessageSize int64
+	if messageCount > 0 {
+		avgMessageSize = int64(atomic.LoadUint64(&t.messageBytes) / messageCount)
+	}
 	return TopicStats{
-		TopicName:    t.name,
-		Channels:     channels,
-		Depth:        t.Depth(),
-		BackendDepth: t.backend.Depth(),
-		MessageCount: atomic.LoadUint64(&t.messageCount),
-		Paused:       t.IsPaused(),
+		TopicName:      t.name,
+		Channels:       channels,
+		Depth:          depth,
+		BackendDepth:   backendDepth,
+		MessageCount:   messageCount,
+		Paused:         t.IsPaused(),
+		PausedAt:       pausedAt,
+		PausedDuration: pausedDuration,
+		SyncEvery:      syncEvery,
+		SyncTimeout:    syncTimeout,
+
+		MemoryDepthBytes: atomic.LoadInt64(&t.memoryBytes),
+
+		HasBackend: hasBackend(t.backend),
+
+		MemQueueFullCount:   atomic.LoadUint64(&t.memQueueFullCount),
+		AvgMessageSizeBytes: avgMessageSize,
+		MaxMessageSizeBytes: atomic.LoadInt64(&t.maxMessageSize),
+
+		ByteRate: t.byteRate.Rate(),
+
+		FanoutRatio: fanoutRatio(channels, messageCount),
+
+		MPubBatchSize: newBatchSizeStats(atomic.LoadUint64(&t.mpubCount),
+			atomic.LoadUint64(&t.mpubMessageCount), atomic.LoadInt64(&t.maxMPubBatchSize)),
+
+		FirstConsumerDelay: firstConsumerDelay,
+
+		LastMessageTimestamp: atomic.LoadInt64(&t.lastMessageAt),
+		Quiet:                t.isQuiet(t.ctx.nsqd.getOpts().QuietTopicThreshold, time.Now()),
+
+		DeferredPublishCount:       atomic.LoadUint64(&t.deferredPublishCount),
+		MaxDeferredPublishDuration: atomic.LoadInt64(&t.maxPublishDeferred),
+		PublishedWhilePausedCount:  atomic.LoadUint64(&t.publishedWhilePausedCount),
+
+		HTTPPublishCount: atomic.LoadUint64(&t.httpPublishCount),
+		TCPPublishCount:  atomic.LoadUint64(&t.tcpPublishCount),
+
+		PubCommandCounts: map[string]uint64{
+			"PUB":  atomic.LoadUint64(&t.pubCommandCount),
+			"MPUB": atomic.LoadUint64(&t.mpubCommandCount),
+			"DPUB": atomic.LoadUint64(&t.dpubCommandCount),
+		},
+
+		TotalChannelsCreated: atomic.LoadUint64(&t.channelsCreated),
+		UniqueClientHosts:    len(hosts),
+		OrphanChannelCount:   t.orphanChannelCount(),
+		BackedUpChannelCount: backedUpChannelCount,
+
+		E2eProcessingLatencyWindow:     int64(e2eWindowTime),
+		E2eProcessingLatencySubWindows: e2eSubWindows,
+
+		LastError:          lastErr,
+		LastErrorTimestamp: lastErrAt,
 
 		E2eProcessingLatency: t.AggregateChannelE2eProcessingLatency().Result(),
 	}
 }
 
+// BatchSizeStats summarises the number of messages per batch (ie. MPUB)
+type BatchSizeStats struct {
+	Count uint64 `json:"count"`
+	Avg   int64  `json:"avg"`
+	Max   int64  `json:"max"`
+}
+
+func newBatchSizeStats(count uint64, messages uint64, max int64) BatchSizeStats {
+	var avg int64
+	if count > 0 {
+		avg = int64(messages / count)
+	}
+	return BatchSizeStats{count, avg, max}
+}
+
 type ChannelStats struct {
-	ChannelName   string        `json:"channel_name"`
-	Depth         int64         `json:"depth"`
-	BackendDepth  int64         `json:"backend_depth"`
-	InFlightCount uint64        `json:"in_flight_count"`
-	DeferredCount uint64        `json:"deferred_count"`
-	MessageCount  uint64        `json:"message_count"`
-	RequeueCount  uint64        `json:"requeue_count"`
-	TimeoutCount  uint64        `json:"timeout_count"`
-	Clients       []ClientStats `json:"clients"`
-	Paused        bool          `json:"paused"`
+	ChannelName        string `json:"channel_name"`
+	ChannelNameEncoded string `json:"channel_name_encoded,omitempty"`
+
+	Depth          int64         `json:"depth"`
+	BackendDepth   int64         `json:"backend_depth"`
+	InFlightCount  uint64        `json:"in_flight_count"`
+	DeferredCount  uint64        `json:"deferred_count"`
+	MessageCount   uint64        `json:"message_count"`
+	RequeueCount   uint64        `json:"requeue_count"`
+	TimeoutCount   uint64        `json:"timeout_count"`
+	Clients        []ClientStats `json:"clients"`
+	Paused         bool          `json:"paused"`
+	PausedAt       int64         `json:"paused_at"`
+	PausedDuration int64         `json:"paused_duration"`
+	DeliverySkew   float64       `json:"delivery_skew"`
+	SyncEvery      int64         `json:"sync_every"`
+	SyncTimeout    int64         `json:"sync_timeout"`
+
+	// size (see messageSize) of the messages held in memory, the size of
+	// those in the backend is not known so this is not the total depth size
+	MemoryDepthBytes int64 `json:"memory_depth_bytes"`
+
+	ClientsTruncated         bool   `json:"clients_truncated"`
+	TotalRdyCount            int64  `json:"total_rdy_count"`
+	AllClientsPaused         bool   `json:"all_clients_paused"`
+	MinClientCount           int    `json:"min_client_count"`
+	MaxClientCount           int    `json:"max_client_count"`
+	UniqueClientHosts        int    `json:"unique_client_hosts"`
+	OverdueInFlightCount     int64  `json:"overdue_in_flight_count"`
+	RetriedInFlightCount     int64  `json:"retried_in_flight_count"`
+	LeakedInFlightCount      int64  `json:"leaked_in_flight_count"`
+	DeferredTimerCount       int    `json:"deferred_timer_count"`
+	MaxAttemptsExceededCount uint64 `json:"max_attempts_exceeded_count"`
+	EmptiedMessageCount      uint64 `json:"emptied_message_count"`
+	TimeEmpty                int64  `json:"time_empty"`
+	TimeNonEmpty             int64  `json:"time_non_empty"`
+	InMemoryDeliveredCount   uint64 `json:"in_memory_delivered_count"`
+	BackendDeliveredCount    uint64 `json:"backend_delivered_count"`
+	TouchedMessageSeconds    int64  `json:"touched_message_seconds"`
+	AbnormalDisconnectCount  uint64 `json:"abnormal_disconnect_count"`
+	HeldByPauseCount         int64  `json:"held_by_pause_count"`
+	DeferredClampedCount     uint64 `json:"deferred_clamped_count"`
+	RdyRejectedCount         uint64 `json:"rdy_rejected_count"`
+	OldestInFlightAge        int64  `json:"oldest_in_flight_age"`
+
+	// deliveries of a message after one with a later ID, this is approximate
+	// (see Channel.recordDeliveryOrder)
+	OutOfOrderDeliveryCount uint64 `json:"out_of_order_delivery_count"`
+
+	// RDY commands that changed a client's RDY after its first one (a repeat
+	// of the same count is not a change). nsqd never changes a client's RDY
+	// itself, so this is how often consumers rebalance theirs
+	RdyChangeCount uint64 `json:"rdy_change_count"`
+
+	// in-flight messages being worked on by a consumer. InFlightCount also
+	// includes messages past their timeout (OverdueInFlightCount) and those of
+	// clients that have gone (LeakedInFlightCount), which are only waiting for
+	// the queue scan to requeue them
+	ProcessingCount int64 `json:"processing_count"`
+
+	// messages delivered by client ID, only set for /stats?client_message_counts=true
+	ClientMessageCounts map[string]uint64 `json:"client_message_counts,omitempty"`
+
+	// --msg-timeout (the default for clients that do not IDENTIFY with their
+	// own) and --max-msg-timeout, in ms
+	MsgTimeout    int64 `json:"msg_timeout"`
+	MaxMsgTimeout int64 `json:"max_msg_timeout"`
+
+	DepthEWMA            float64 `json:"depth_ewma"`
+	DeferredRatio        float64 `json:"deferred_ratio"`
+	TimeoutRate          float64 `json:"timeout_rate"`
+	TimeoutRateTrend     float64 `json:"timeout_rate_trend"`
+	TimeWeightedAvgDepth float64 `json:"time_weighted_avg_depth"`
+
+	LastError          string `json:"last_error"`
+	LastErrorTimestamp int64  `json:"last_error_ts"`
 
 	E2eProcessingLatency *quantile.Result `json:"e2e_processing_latency"`
+	DwellTime            *quantile.Result `json:"dwell_time"`
+	DispatchLatency      *quantile.Result `json:"dispatch_latency"`
 }
 
-func NewChannelStats(c *Channel, clients []ClientStats) ChannelStats {
+// NewChannelStats returns the stats for c, when approximate the depths are the
+// ones last sampled by depthSampleLoop rather than read from the backend
+func NewChannelStats(c *Channel, clients []ClientStats, approximate bool) ChannelStats {
+	opts := c.ctx.nsqd.getOpts()
+	depth, backendDepth := c.depths(approximate)
+	syncEvery, syncTimeout := backendSyncStats(c.backend, opts)
+	timeEmpty, timeNonEmpty := c.emptyDurations()
+	lastErr, lastErrAt := c.lastError.get()
+	pausedAt, pausedDuration := pausedStats(atomic.LoadInt64(&c.pausedAt))
+	minClientCount, maxClientCount := c.clientCountHistory.bounds(len(clients),
+		opts.ClientCountWindow, time.Now())
+	var totalRdyCount int64
+	for _, client := range clients {
+		totalRdyCount += client.ReadyCount
+	}
+	deferredCount := atomic.LoadUint64(&c.deferredCount)
+	// while paused everything queued (but not deferred) could be delivered
+	paused := c.IsPaused()
+	var heldByPauseCount int64
+	if paused {
+		heldByPauseCount = depth
+	}
+	now := time.Now()
+	inFlight := c.inFlightStats(now)
+	for i := range clients {
+		clients[i].QualityScore = clientQualityScore(clients[i], inFlight.nearTimeout[clients[i].id], opts, now)
+		clients[i].OverdueInFlightCount = inFlight.overdueByClient[clients[i].id]
+	}
 	return ChannelStats{
-		ChannelName:   c.name,
-		Depth:         c.Depth(),
-		BackendDepth:  c.backend.Depth(),
-		InFlightCount: atomic.LoadUint64(&c.inFlightCount),
-		DeferredCount: atomic.LoadUint64(&c.deferredCount),
-		MessageCount:  atomic.LoadUint64(&c.messageCount),
-		RequeueCount:  atomic.LoadUint64(&c.requeueCount),
-		TimeoutCount:  atomic.LoadUint64(&c.timeoutCount),
-		Clients:       clients,
-		Paused:        c.IsPaused(),
+		ChannelName:    c.name,
+		Depth:          depth,
+		BackendDepth:   backendDepth,
+		InFlightCount:  atomic.LoadUint64(&c.inFlightCount),
+		DeferredCount:  deferredCount,
+		MessageCount:   atomic.LoadUint64(&c.messageCount),
+		RequeueCount:   atomic.LoadUint64(&c.requeueCount),
+		TimeoutCount:   atomic.LoadUint64(&c.timeoutCount),
+		Clients:        clients,
+		Paused:         paused,
+		PausedAt:       pausedAt,
+		PausedDuration: pausedDuration,
+		DeliverySkew:   deliverySkew(clients),
+		SyncEvery:      syncEvery,
+		SyncTimeout:    syncTimeout,
+
+		MemoryDepthBytes: atomic.LoadInt64(&c.memoryBytes),
+
+		TotalRdyCount:            totalRdyCount,
+		AllClientsPaused:         len(clients) > 0 && totalRdyCount == 0,
+		MinClientCount:           minClientCount,
+		MaxClientCount:           maxClientCount,
+		UniqueClientHosts:        len(clientHosts(clients, nil)),
+		OverdueInFlightCount:     inFlight.overdue,
+		RetriedInFlightCount:     atomic.LoadInt64(&c.retriedInFlightCount),
+		LeakedInFlightCount:      inFlight.leaked,
+		DeferredTimerCount:       c.deferredTimerCount(),
+		MaxAttemptsExceededCount: atomic.LoadUint64(&c.maxAttemptsExceededCount),
+		EmptiedMessageCount:      atomic.LoadUint64(&c.emptiedMessageCount),
+		TimeEmpty:                timeEmpty,
+		TimeNonEmpty:             timeNonEmpty,
+		InMemoryDeliveredCount:   atomic.LoadUint64(&c.inMemoryDeliveredCount),
+		BackendDeliveredCount:    atomic.LoadUint64(&c.backendDeliveredCount),
+		TouchedMessageSeconds:    atomic.LoadInt64(&c.touchedNanos) / int64(time.Second),
+		AbnormalDisconnectCount:  atomic.LoadUint64(&c.abnormalDisconnectCount),
+		HeldByPauseCount:         heldByPauseCount,
+		DeferredClampedCount:     atomic.LoadUint64(&c.deferredClampedCount),
+		RdyRejectedCount:         atomic.LoadUint64(&c.rdyRejectedCount),
+		OldestInFlightAge:        inFlight.oldestAge(now),
+
+		OutOfOrderDeliveryCount: atomic.LoadUint64(&c.outOfOrderDeliveryCount),
+
+		RdyChangeCount: atomic.LoadUint64(&c.rdyChangeCount),
+
+		ProcessingCount: inFlight.processing,
+
+		MsgTimeout:    int64(opts.MsgTimeout / time.Millisecond),
+		MaxMsgTimeout: int64(opts.MaxMsgTimeout / time.Millisecond),
+
+		DepthEWMA:            math.Float64frombits(atomic.LoadUint64(&c.depthEWMA)),
+		DeferredRatio:        deferredRatio(deferredCount, depth),
+		TimeoutRate:          c.timeoutTrend.rate(depthSampleInterval),
+		TimeoutRateTrend:     c.timeoutTrend.slope(depthSampleInterval),
+		TimeWeightedAvgDepth: c.timeWeightedAvgDepth(),
+
+		LastError:          lastErr,
+		LastErrorTimestamp: lastErrAt,
 
 		E2eProcessingLatency: c.e2eProcessingLatencyStream.Result(),
+		DwellTime:            c.dwellTimeStream.Result(),
+		DispatchLatency:      c.dispatchLatencyStream.Result(),
 	}
 }
 
+// clientQualityScore is a weighted average (using the --quality-score-*-weight
+// options) of each of these, which are 1 for a healthy client and 0 for the
+// worst:
+//
+//	idle:         1 - min(time since last command / --client-timeout, 1)
+//	write errors: 1 / (1 + WriteErrorCount)
+//	RDY:          1 - min(InFlightCount / ReadyCount, 1), 1 when RDY is 0
+//	near timeout: 1 - (in-flight past 3/4 of their timeout / InFlightCount),
+//	              1 when nothing is in-flight
+//
+// so 1 is an active client with spare RDY that has not had write errors and
+// is finishing messages well within their timeout
+func clientQualityScore(cs ClientStats, nearTimeout int64, opts *Options, now time.Time) float64 {
+	lastActive := cs.LastCommandTimestamp
+	if lastActive == 0 {
+		lastActive = cs.ConnectTime * int64(time.Second)
+	}
+	idle := 1 - math.Min(float64(now.UnixNano()-lastActive)/float64(opts.ClientTimeout), 1)
+	idle = math.Max(idle, 0)
+	writeErrors := 1 / (1 + float64(cs.WriteErrorCount))
+	rdy := float64(1)
+	if cs.ReadyCount > 0 {
+		rdy = 1 - math.Min(float64(cs.InFlightCount)/float64(cs.ReadyCount), 1)
+	}
+	timeouts := float64(1)
+	if cs.InFlightCount > 0 {
+		timeouts = 1 - math.Min(float64(nearTimeout)/float64(cs.InFlightCount), 1)
+	}
+
+	weightSum := opts.QualityScoreIdleWeight + opts.QualityScoreWriteErrorWeight +
+		opts.QualityScoreRdyWeight + opts.QualityScoreNearTimeoutWeight
+	if weightSum == 0 {
+		return 0
+	}
+	return (opts.QualityScoreIdleWeight*idle +
+		opts.QualityScoreWriteErrorWeight*writeErrors +
+		opts.QualityScoreRdyWeight*rdy +
+		opts.QualityScoreNearTimeoutWeight*timeouts) / weightSum
+}
+
+// fanoutRatio is the total channel message count over the topic's (zero
+// before anything is published), ie. how many times each message is
+// delivered. When the stats are filtered to one channel only that channel
+// counts.
+func fanoutRatio(channels []ChannelStats, messageCount uint64) float64 {
+	if messageCount == 0 {
+		return 0
+	}
+	var channelMessageCount uint64
+	for _, c := range channels {
+		channelMessageCount += c.MessageCount
+	}
+	return float64(channelMessageCount) / float64(messageCount)
+}
+
+// deferredRatio is deferredCount / depth (zero for an empty channel), deferred
+// messages are not part of the depth so it is > 1 once they outnumber it
+func deferredRatio(deferredCount uint64, depth int64) float64 {
+	if depth <= 0 {
+		return 0
+	}
+	return float64(deferredCount) / float64(depth)
+}
+
+// pausedStats converts a pause timestamp (in ns) into the unix time it was
+// paused at and how long (in seconds) it has been paused for, both zero when
+// it is not paused
+func pausedStats(pausedAt int64) (int64, int64) {
+	if pausedAt == 0 {
+		return 0, 0
+	}
+	t := time.Unix(0, pausedAt)
+	return t.Unix(), int64(time.Since(t).Seconds())
+}
+
+// backendSyncStats returns the --sync-every and --sync-timeout (in ns) the
+// backend was created with, both zero for memory-only (ephemeral) backends
+func backendSyncStats(b BackendQueue, opts *Options) (int64, int64) {
+	if _, ok := b.(*dummyBackendQueue); ok {
+		return 0, 0
+	}
+	return opts.SyncEvery, int64(opts.SyncTimeout)
+}
+
+// clientHosts adds the distinct Hostname of clients to hosts (allocating it if
+// nil) and returns it
+func clientHosts(clients []ClientStats, hosts map[string]struct{}) map[string]struct{} {
+	if hosts == nil {
+		hosts = make(map[string]struct{}, len(clients))
+	}
+	for _, c := range clients {
+		hosts[c.Hostname] = struct{}{}
+	}
+	return hosts
+}
+
+// hasBackend is false for the memory-only backend of ephemeral topics and
+// channels, whose backend fields (depth, sync) are always zero
+func hasBackend(b BackendQueue) bool {
+	_, ok := b.(*dummyBackendQueue)
+	return !ok
+}
+
+// deliverySkew is the ratio of the largest to the smallest client
+// MessageCount, 1 is perfectly even distribution (0 if there are fewer than
+// two clients or nothing has been delivered). A client that has not been sent
+// anything is counted as 1 to keep the ratio finite.
+func deliverySkew(clients []ClientStats) float64 {
+	if len(clients) < 2 {
+		return 0
+	}
+	min, max := clients[0].MessageCount, clients[0].MessageCount
+	for _, c := range clients[1:] {
+		if c.MessageCount < min {
+			min = c.MessageCount
+		}
+		if c.MessageCount > max {
+			max = c.MessageCount
+		}
+	}
+	if max == 0 {
+		return 0
+	}
+	if min == 0 {
+		min = 1
+	}
+	return float64(max) / float64(min)
+}
+
 type ClientStats struct {
-	ClientID        string `json:"client_id"`
-	Hostname        string `json:"hostname"`
-	Version         string `json:"version"`
-	RemoteAddress   string `json:"remote_address"`
-	State           int32  `json:"state"`
-	ReadyCount      int64  `json:"ready_count"`
-	InFlightCount   int64  `json:"in_flight_count"`
-	MessageCount    uint64 `json:"message_count"`
-	FinishCount     uint64 `json:"finish_count"`
-	RequeueCount    uint64 `json:"requeue_count"`
-	ConnectTime     int64  `json:"connect_ts"`
-	SampleRate      int32  `json:"sample_rate"`
-	Deflate         bool   `json:"deflate"`
-	Snappy          bool   `json:"snappy"`
-	UserAgent       string `json:"user_agent"`
-	Authed          bool   `json:"authed,omitempty"`
-	AuthIdentity    string `json:"auth_identity,omitempty"`
-	AuthIdentityURL string `json:"auth_identity_url,omitempty"`
+	ClientID        string  `json:"client_id"`
+	Hostname        string  `json:"hostname"`
+	Version         string  `json:"version"`
+	RemoteAddress   string  `json:"remote_address"`
+	State           int32   `json:"state"`
+	ReadyCount      int64   `json:"ready_count"`
+	InFlightCount   int64   `json:"in_flight_count"`
+	MessageCount    uint64  `json:"message_count"`
+	MessageRate     float64 `json:"message_rate"`
+	FinishCount     uint64  `json:"finish_count"`
+	RequeueCount    uint64  `json:"requeue_count"`
+	ConnectTime     int64   `json:"connect_ts"`
+	SampleRate      int32   `json:"sample_rate"`
+	Deflate         bool    `json:"deflate"`
+	Snappy          bool    `json:"snappy"`
+	UserAgent       string  `json:"user_agent"`
+	Topic           string  `json:"topic"`
+	Channel         string  `json:"channel"`
+	Authed          bool    `json:"authed,omitempty"`
+	AuthIdentity    string  `json:"auth_identity,omitempty"`
+	AuthIdentityURL string  `json:"auth_identity_url,omitempty"`
+
+	CompressionRatio float64 `json:"compression_ratio"`
+
+	LastCommand          string `json:"last_command"`
+	LastCommandTimestamp int64  `json:"last_command_ts"`
+
+	WriteErrorCount uint64 `json:"write_error_count"`
+
+	MissedHeartbeatCount uint64 `json:"missed_heartbeat_count"`
+
+	BufferedMessageCount int `json:"buffered_message_count"`
+	BufferedBytes        int `json:"buffered_bytes"`
+
+	QualityScore float64 `json:"quality_score"`
+
+	// in-flight messages past their timeout, like the channel's but for this
+	// client only
+	OverdueInFlightCount int `json:"overdue_in_flight_count"`
+
+	// time from sending a message to this client to its FIN, only with
+	// --ack-latency
+	AckLatency *quantile.Result `json:"ack_latency,omitempty"`
+
+	// for attributing channel in-flight messages, it is not reported
+	id int64
 
 	TLS                           bool   `json:"tls"`
 	CipherSuite                   string `json:"tls_cipher_suite"`
@@ -93,6 +544,166 @@ type ClientStats struct {
 	TLSNegotiatedProtocolIsMutual bool   `json:"tls_negotiated_protocol_is_mutual"`
 }
 
+type LookupdStats struct {
+	Address   string `json:"address"`
+	Connected bool   `json:"connected"`
+}
+
+// statsKeyFields are always kept when filtering stats by field so that the
+// remaining values can still be attributed (and nested) correctly
+var statsKeyFields = map[string]bool{
+	"topic_name":   true,
+	"channel_name": true,
+	"client_id":    true,
+	"channels":     true,
+	"clients":      true,
+}
+
+// statsFieldNames is the set of JSON field names across TopicStats, ChannelStats
+// and ClientStats
+var statsFieldNames = jsonFieldNames(TopicStats{}, ChannelStats{}, ClientStats{})
+
+func jsonFieldNames(vs ...interface{}) map[string]bool {
+	names := make(map[string]bool)
+	for _, v := range vs {
+		typ := reflect.TypeOf(v)
+		for i := 0; i < typ.NumField(); i++ {
+			name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+			if name != "" && name != "-" {
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
+
+// filterStatsFields returns stats with only the requested JSON fields (plus
+// statsKeyFields) at the topic, channel and client level, along with any
+// requested field names that do not exist
+func filterStatsFields(stats []TopicStats, fields []string) ([]map[string]interface{}, []string, error) {
+	keep := make(map[string]bool, len(fields)+len(statsKeyFields))
+	for k := range statsKeyFields {
+		keep[k] = true
+	}
+	var unknown []string
+	for _, f := range fields {
+		if !statsFieldNames[f] {
+			unknown = append(unknown, f)
+			continue
+		}
+		keep[f] = true
+	}
+
+	// round trip through JSON (preserving number precision) so that the
+	// filtered output is named and formatted exactly like the full output
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return nil, nil, err
+	}
+	filtered := make([]map[string]interface{}, 0, len(stats))
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err = dec.Decode(&filtered)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, t := range filtered {
+		filterFields(t, keep)
+	}
+	return filtered, unknown, nil
+}
+
+func filterFields(m map[string]interface{}, keep map[string]bool) {
+	for k, v := range m {
+		if !keep[k] {
+			delete(m, k)
+			continue
+		}
+		if children, ok := v.([]interface{}); ok {
+			for _, child := range children {
+				if cm, ok := child.(map[string]interface{}); ok {
+					filterFields(cm, keep)
+				}
+			}
+		}
+	}
+}
+
+// clientSortKeys are the ClientStats metrics that clients can be sorted by
+var clientSortKeys = map[string]func(ClientStats) float64{
+	"ready_count":     func(c ClientStats) float64 { return float64(c.ReadyCount) },
+	"in_flight_count": func(c ClientStats) float64 { return float64(c.InFlightCount) },
+	"message_count":   func(c ClientStats) float64 { return float64(c.MessageCount) },
+	"message_rate":    func(c ClientStats) float64 { return c.MessageRate },
+	"finish_count":    func(c ClientStats) float64 { return float64(c.FinishCount) },
+	"requeue_count":   func(c ClientStats) float64 { return float64(c.RequeueCount) },
+	// oldest connections first
+	"connect_ts": func(c ClientStats) float64 { return -float64(c.ConnectTime) },
+}
+
+// sortAndLimitClients sorts every channel's clients (descending) by the given
+// clientSortKeys metric (if any) and then truncates them to limit (if > 0)
+func sortAndLimitClients(stats []TopicStats, sortBy string, limit int) {
+	key := clientSortKeys[sortBy]
+	for _, t := range stats {
+		for i := range t.Channels {
+			c := &t.Channels[i]
+			if key != nil {
+				sort.Stable(ClientStatsByKey{c.Clients, key})
+			}
+			if limit > 0 && len(c.Clients) > limit {
+				c.Clients = c.Clients[:limit]
+				c.ClientsTruncated = true
+			}
+		}
+	}
+}
+
+// setClientMessageCounts sets each channel's ClientMessageCounts from all of
+// its clients, so it should be called before they are limited
+func setClientMessageCounts(stats []TopicStats) {
+	for i := range stats {
+		for j := range stats[i].Channels {
+			c := &stats[i].Channels[j]
+			c.ClientMessageCounts = make(map[string]uint64, len(c.Clients))
+			for _, client := range c.Clients {
+				c.ClientMessageCounts[client.ClientID] = client.MessageCount
+			}
+		}
+	}
+}
+
+// encodeStatsNames sets the (URL safe) base64 encoded topic and channel names
+// for tooling that cannot handle some of the characters valid in names
+func encodeStatsNames(stats []TopicStats) {
+	for i := range stats {
+		t := &stats[i]
+		t.TopicNameEncoded = base64.URLEncoding.EncodeToString([]byte(t.TopicName))
+		for j := range t.Channels {
+			c := &t.Channels[j]
+			c.ChannelNameEncoded = base64.URLEncoding.EncodeToString([]byte(c.ChannelName))
+		}
+	}
+}
+
+// roundStatsQuantiles rounds all the topic and channel quantile values to
+// the given number of significant digits
+func roundStatsQuantiles(stats []TopicStats, digits int) {
+	for i := range stats {
+		t := &stats[i]
+		t.E2eProcessingLatency.Round(digits)
+		for j := range t.Channels {
+			c := &t.Channels[j]
+			c.E2eProcessingLatency.Round(digits)
+			c.DwellTime.Round(digits)
+			c.DispatchLatency.Round(digits)
+			for k := range c.Clients {
+				c.Clients[k].AckLatency.Round(digits)
+			}
+		}
+	}
+}
+
 type Topics []*Topic
 
 func (t Topics) Len() int      { return len(t) }
@@ -141,8 +752,31 @@ func (c ChannelStatsByChannelName) Less(i, j int) bool {
 	return c.ChannelStatsS[i].ChannelName < c.ChannelStatsS[j].ChannelName
 }
 
+type ClientStatsByKey struct {
+	Clients []ClientStats
+	Key     func(ClientStats) float64
+}
+
+func (c ClientStatsByKey) Len() int      { return len(c.Clients) }
+func (c ClientStatsByKey) Swap(i, j int) { c.Clients[i], c.Clients[j] = c.Clients[j], c.Clients[i] }
+func (c ClientStatsByKey) Less(i, j int) bool {
+	return c.Key(c.Clients[i]) > c.Key(c.Clients[j])
+}
+
 func (n *NSQD) GetStats(topic string, channel string) []TopicStats {
+	return n.getStats(topic, channel, false)
+}
+
+// GetApproximateStats is like GetStats but reports the depths sampled by
+// depthSampleLoop instead of querying every backend, so they can be up to
+// depthSampleInterval (1s) stale
+func (n *NSQD) GetApproximateStats(topic string, channel string) []TopicStats {
+	return n.getStats(topic, channel, true)
+}
+
+func (n *NSQD) getStats(topic string, channel string, approximate bool) []TopicStats {
 	topicAcquireStart := time.Now()
+	profiler := &statsProfiler{start: topicAcquireStart}
 	n.RLock()
 	nsqdRlockAcquireDuration := time.Since(topicAcquireStart)
 	var realTopics []*Topic
@@ -159,8 +793,37 @@ func (n *NSQD) GetStats(topic string, channel string) []TopicStats {
 	}
 	n.RUnlock()
 	topicAcquireDuration := time.Since(topicAcquireStart)
+	profiler.add(&profiler.nsqdLock, nsqdRlockAcquireDuration)
+	profiler.add(&profiler.topicList, topicAcquireDuration-nsqdRlockAcquireDuration)
 	n.logf(LOG_DEBUG, "stats: acquiring topic list - took %v to acquire nsqd lock", nsqdRlockAcquireDuration)
 	n.logf(LOG_DEBUG, "stats: acquired topic list (under lock) in %v", topicAcquireDuration)
+	return n.getTopicsStats(realTopics, channel, approximate, profiler)
+}
+
+// GetStatsForTopics is like GetStats (or GetApproximateStats) but for exactly
+// the given topics, any that do not exist are skipped
+func (n *NSQD) GetStatsForTopics(topicNames []string, channel string, approximate bool) []TopicStats {
+	topicAcquireStart := time.Now()
+	profiler := &statsProfiler{start: topicAcquireStart}
+	n.RLock()
+	nsqdRlockAcquireDuration := time.Since(topicAcquireStart)
+	realTopics := make([]*Topic, 0, len(topicNames))
+	seen := make(map[string]bool, len(topicNames))
+	for _, name := range topicNames {
+		if t, exists := n.topicMap[name]; exists && !seen[name] {
+			seen[name] = true
+			realTopics = append(realTopics, t)
+		}
+	}
+	n.RUnlock()
+	topicAcquireDuration := time.Since(topicAcquireStart)
+	profiler.add(&profiler.nsqdLock, nsqdRlockAcquireDuration)
+	profiler.add(&profiler.topicList, topicAcquireDuration-nsqdRlockAcquireDuration)
+	n.logf(LOG_DEBUG, "stats: acquired topic list (under lock) in %v", topicAcquireDuration)
+	return n.getTopicsStats(realTopics, channel, approximate, profiler)
+}
+
+func (n *NSQD) getTopicsStats(realTopics []*Topic, channel string, approximate bool, profiler *statsProfiler) []TopicStats {
 	topics := make([]TopicStats, 0, len(realTopics))
 	var topicsMutex sync.Mutex
 	var topicsWG sync.WaitGroup
@@ -185,6 +848,8 @@ func (n *NSQD) GetStats(topic string, channel string) []TopicStats {
 			}
 			t.RUnlock()
 			channelAcquireDuration := time.Since(topicLockStart)
+			profiler.add(&profiler.topicLock, channelAcquireDuration)
+			atomic.AddInt64(&profiler.channelCount, int64(len(realChannels)))
 			n.logf(LOG_DEBUG, "stats: topic (%v) rlock acquired in %v", t.name, topicLockAcquireDuration)
 			n.logf(LOG_DEBUG, "stats: acquired channels (under lock) for topic (%s) in %v", t.name, channelAcquireDuration)
 			channels := make([]ChannelStats, 0, len(realChannels))
@@ -201,14 +866,18 @@ func (n *NSQD) GetStats(topic string, channel string) []TopicStats {
 						clients = append(clients, client.Stats())
 					}
 					c.RUnlock()
-					n.logf(LOG_DEBUG, "stats: acquired clients (under lock) for topic/channel (%s/%s) in %v", t.name, c.name, time.Since(channelLockStart))
+					channelLockDuration := time.Since(channelLockStart)
+					profiler.add(&profiler.channelLock, channelLockDuration)
+					n.logf(LOG_DEBUG, "stats: acquired clients (under lock) for topic/channel (%s/%s) in %v", t.name, c.name, channelLockDuration)
 					channelStatsStart := time.Now()
 					// calculate outside lock, as this aggregates e2e latency
-					cs := NewChannelStats(c, clients)
+					cs := NewChannelStats(c, clients, approximate)
 					channelsMutex.Lock()
 					channels = append(channels, cs)
 					channelsMutex.Unlock()
-					n.logf(LOG_DEBUG, "stats: acquired channel stats for topic/channel (%s/%s) in %v", t.name, c.name, time.Since(channelStatsStart))
+					channelStatsDuration := time.Since(channelStatsStart)
+					profiler.add(&profiler.channelStats, channelStatsDuration)
+					n.logf(LOG_DEBUG, "stats: acquired channel stats for topic/channel (%s/%s) in %v", t.name, c.name, channelStatsDuration)
 				}(c)
 			}
 			channelsWG.Wait()
@@ -216,20 +885,278 @@ func (n *NSQD) GetStats(topic string, channel string) []TopicStats {
 
 			topicStatsStart := time.Now()
 			// calculate outside lock, as this aggregates e2e latency
-			ts := NewTopicStats(t, channels)
+			ts := NewTopicStats(t, channels, approximate)
 			topicsMutex.Lock()
 			topics = append(topics, ts)
 			topicsMutex.Unlock()
-			n.logf(LOG_DEBUG, "stats: acquired topic stats for topic (%s) in %v", t.name, time.Since(topicStatsStart))
+			topicStatsDuration := time.Since(topicStatsStart)
+			profiler.add(&profiler.topicStats, topicStatsDuration)
+			n.logf(LOG_DEBUG, "stats: acquired topic stats for topic (%s) in %v", t.name, topicStatsDuration)
 		}(t)
 	}
 	topicsWG.Wait()
 	sort.Sort(TopicStatsByTopicName{topics})
 
-	n.logf(LOG_DEBUG, "stats: finished acquiring stats in %v", time.Since(topicAcquireStart))
+	profiler.finish(n, len(topics))
+	n.logf(LOG_DEBUG, "stats: finished acquiring stats in %v", time.Since(profiler.start))
+	return topics
+}
+
+// GetClusterStats fetches /stats from each of --stats-cluster-node and merges
+// them into one TopicStats per topic (and ChannelStats per channel), the
+// per-node stats are kept in each NodeStats
+//
+// a non-nil error with results means some (but not all) nodes failed, in that
+// case the error is a clusterinfo.PartialErr
+func (n *NSQD) GetClusterStats(topic string, channel string) ([]*clusterinfo.TopicStats, error) {
+	var producers clusterinfo.Producers
+	for _, addr := range n.getOpts().StatsClusterNodes {
+		host, portString, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stats cluster node %q - %s", addr, err)
+		}
+		port, err := strconv.Atoi(portString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stats cluster node %q - %s", addr, err)
+		}
+		producers = append(producers, &clusterinfo.Producer{
+			BroadcastAddress: host,
+			Hostname:         host,
+			HTTPPort:         port,
+		})
+	}
+
+	nodeTopics, channelStatsMap, statsErr := n.ci.GetNSQDStats(producers, topic, channel)
+	if statsErr != nil {
+		if _, ok := statsErr.(clusterinfo.PartialErr); !ok {
+			return nil, statsErr
+		}
+	}
+
+	// channels are already merged (across nodes) by GetNSQDStats, so topics are
+	// merged without them to avoid TopicStats.Add folding channel counts into
+	// the per-node stats
+	topicsMap := make(map[string]*clusterinfo.TopicStats)
+	var topicNames []string
+	for _, t := range nodeTopics {
+		ts, ok := topicsMap[t.TopicName]
+		if !ok {
+			ts = &clusterinfo.TopicStats{TopicName: t.TopicName}
+			topicsMap[t.TopicName] = ts
+			topicNames = append(topicNames, t.TopicName)
+		}
+		nodeTopic := *t
+		nodeTopic.Channels = nil
+		ts.Add(&nodeTopic)
+	}
+	for _, c := range channelStatsMap {
+		if ts, ok := topicsMap[c.TopicName]; ok {
+			ts.Channels = append(ts.Channels, c)
+		}
+	}
+
+	sort.Strings(topicNames)
+	topics := make([]*clusterinfo.TopicStats, 0, len(topicNames))
+	for _, name := range topicNames {
+		ts := topicsMap[name]
+		sort.Sort(clusterinfo.ChannelStatsByName{ts.Channels})
+		topics = append(topics, ts)
+	}
+	return topics, statsErr
+}
+
+// writeStatsChecksum feeds a cheap aggregate of the node's stats into h,
+// without building the full per-client stats (see GetStats).
+//
+// It covers the number of topics, channels, clients and paused topics/channels
+// along with the totals (across all topics and channels) of message, depth,
+// in-flight, deferred, requeue and timeout counts. It does NOT cover memory
+// stats, uptime, e2e latency percentiles or per-client counters, and because
+// the values are summed a change that moves counts between topics/channels
+// without changing the totals goes unnoticed.
+func (n *NSQD) writeStatsChecksum(h hash.Hash64) {
+	n.RLock()
+	realTopics := make([]*Topic, 0, len(n.topicMap))
+	for _, t := range n.topicMap {
+		realTopics = append(realTopics, t)
+	}
+	n.RUnlock()
+
+	var channelCount, clientCount, pausedCount uint64
+	var topicMessages, topicDepth uint64
+	var messages, depth, inFlight, deferred, requeues, timeouts uint64
+	for _, t := range realTopics {
+		t.RLock()
+		realChannels := make([]*Channel, 0, len(t.channelMap))
+		for _, c := range t.channelMap {
+			realChannels = append(realChannels, c)
+		}
+		t.RUnlock()
+
+		if t.IsPaused() {
+			pausedCount++
+		}
+		topicMessages += atomic.LoadUint64(&t.messageCount)
+		topicDepth += uint64(t.Depth())
+		for _, c := range realChannels {
+			c.RLock()
+			clientCount += uint64(len(c.clients))
+			c.RUnlock()
+
+			if c.IsPaused() {
+				pausedCount++
+			}
+			channelCount++
+			messages += atomic.LoadUint64(&c.messageCount)
+			depth += uint64(c.Depth())
+			inFlight += atomic.LoadUint64(&c.inFlightCount)
+			deferred += atomic.LoadUint64(&c.deferredCount)
+			requeues += atomic.LoadUint64(&c.requeueCount)
+			timeouts += atomic.LoadUint64(&c.timeoutCount)
+		}
+	}
+
+	var b [8]byte
+	for _, v := range []uint64{uint64(len(realTopics)), channelCount, clientCount, pausedCount,
+		topicMessages, topicDepth, messages, depth, inFlight, deferred, requeues, timeouts} {
+		binary.BigEndian.PutUint64(b[:], v)
+		h.Write(b[:])
+	}
+}
+
+// TopologyTopic is a topic and the names of its channels, see GetTopology
+type TopologyTopic struct {
+	TopicName string   `json:"topic_name"`
+	Channels  []string `json:"channels"`
+}
+
+// GetTopology returns every topic and its channels, sorted by name. Only the
+// maps are read (each under a brief read lock) so it is much cheaper than
+// GetStats.
+func (n *NSQD) GetTopology() []TopologyTopic {
+	n.RLock()
+	realTopics := make([]*Topic, 0, len(n.topicMap))
+	for _, t := range n.topicMap {
+		realTopics = append(realTopics, t)
+	}
+	n.RUnlock()
+
+	topics := make([]TopologyTopic, 0, len(realTopics))
+	for _, t := range realTopics {
+		t.RLock()
+		channels := make([]string, 0, len(t.channelMap))
+		for name := range t.channelMap {
+			channels = append(channels, name)
+		}
+		t.RUnlock()
+		sort.Strings(channels)
+		topics = append(topics, TopologyTopic{t.name, channels})
+	}
+	sort.Sort(topologyTopicsByName(topics))
 	return topics
 }
 
+type topologyTopicsByName []TopologyTopic
+
+func (t topologyTopicsByName) Len() int           { return len(t) }
+func (t topologyTopicsByName) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t topologyTopicsByName) Less(i, j int) bool { return t[i].TopicName < t[j].TopicName }
+
+// GetTLSHandshakeFailureCount returns the number of incoming TLS handshakes
+// that have failed
+func (n *NSQD) GetTLSHandshakeFailureCount() uint64 {
+	return atomic.LoadUint64(&n.tlsHandshakeFailureCount)
+}
+
+// GetCompressionNegotiationFailureCount returns the number of IDENTIFYs whose
+// requested compression could not be enabled
+func (n *NSQD) GetCompressionNegotiationFailureCount() uint64 {
+	return atomic.LoadUint64(&n.compressionNegotiationFailureCount)
+}
+
+// GetBlockedSubCount returns the number of SUB commands currently waiting to
+// get their topic and channel (and be added as a client)
+func (n *NSQD) GetBlockedSubCount() int {
+	return int(atomic.LoadInt64(&n.blockedSubCount))
+}
+
+// GetClientVersions returns the number of TCP clients, subscribed or not, by
+// UserAgent (or protocol Version for clients that did not IDENTIFY with one)
+func (n *NSQD) GetClientVersions() map[string]int {
+	n.clientVersionsLock.Lock()
+	versions := make(map[string]int, len(n.clientVersions))
+	for version, count := range n.clientVersions {
+		versions[version] = count
+	}
+	n.clientVersionsLock.Unlock()
+	return versions
+}
+
+// moveClientVersion moves a client from being counted under one version to
+// another, from is "" for a client connecting and to is "" for one closing
+func (n *NSQD) moveClientVersion(from string, to string) {
+	if from == to {
+		return
+	}
+	n.clientVersionsLock.Lock()
+	if from != "" {
+		n.clientVersions[from]--
+		if n.clientVersions[from] == 0 {
+			delete(n.clientVersions, from)
+		}
+	}
+	if to != "" {
+		n.clientVersions[to]++
+	}
+	n.clientVersionsLock.Unlock()
+}
+
+// GetGUIDErrorCount returns the number of message ID generation errors
+func (n *NSQD) GetGUIDErrorCount() uint64 {
+	return atomic.LoadUint64(&n.guidErrorCount)
+}
+
+// GetAcceptedConnectionCount returns the number of TCP connections accepted
+// since startup
+func (n *NSQD) GetAcceptedConnectionCount() uint64 {
+	return atomic.LoadUint64(&n.acceptedConnectionCount)
+}
+
+// GetOrphanChannelCount returns the number of channels (across all topics)
+// that have never had a client
+func (n *NSQD) GetOrphanChannelCount() int {
+	var count int
+	for _, c := range n.channels() {
+		if atomic.LoadInt32(&c.hadClient) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// GetTotalBackendBytes sums the size of the diskqueue data files in
+// --data-path, ie. everything held on disk by topic and channel backends
+// (including data that has been read but whose file is not yet removed)
+func (n *NSQD) GetTotalBackendBytes() int64 {
+	files, err := ioutil.ReadDir(n.getOpts().DataPath)
+	if err != nil {
+		n.logf(LOG_ERROR, "failed to read data path - %s", err)
+		return 0
+	}
+	var total int64
+	for _, fi := range files {
+		name := fi.Name()
+		if !fi.Mode().IsRegular() ||
+			!strings.Contains(name, ".diskqueue.") ||
+			!strings.HasSuffix(name, ".dat") ||
+			strings.HasSuffix(name, ".diskqueue.meta.dat") {
+			continue
+		}
+		total += fi.Size()
+	}
+	return total
+}
+
 type memStats struct {
 	HeapObjects       uint64 `json:"heap_objects"`
 	HeapIdleBytes     uint64 `json:"heap_idle_bytes"`
@@ -240,6 +1167,8 @@ type memStats struct {
 	GCPauseUsec95     uint64 `json:"gc_pause_usec_95"`
 	NextGCBytes       uint64 `json:"next_gc_bytes"`
 	GCTotalRuns       uint32 `json:"gc_total_runs"`
+	GCTotalPauseUsec  uint64 `json:"gc_total_pause_usec"`
+	ProcessRSSBytes   int64  `json:"process_rss_bytes"`
 }
 
 func getMemStats() memStats {
@@ -255,6 +1184,9 @@ func getMemStats() memStats {
 	copy(gcPauses, ms.PauseNs[:length])
 	sort.Sort(gcPauses)
 
+	// best-effort, zero where it is not supported
+	rss, _ := processRSSBytes()
+
 	return memStats{
 		ms.HeapObjects,
 		ms.HeapIdle,
@@ -265,6 +1197,8 @@ func getMemStats() memStats {
 		percentile(95.0, gcPauses, len(gcPauses)) / 1000,
 		ms.NextGC,
 		ms.NumGC,
+		ms.PauseTotalNs / 1000,
+		rss,
 	}
 
 }
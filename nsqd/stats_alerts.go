@@ -0,0 +1,48 @@
+package nsqd
+
+// StatsAlert is a topic (ChannelName is empty) or channel over one of the
+// --alert-*-threshold options, Condition is "depth", "age" (the oldest
+// in-flight message, in ns) or "timeout_rate" (timeouts/sec over the last
+// minute)
+type StatsAlert struct {
+	TopicName   string  `json:"topic_name"`
+	ChannelName string  `json:"channel_name,omitempty"`
+	Condition   string  `json:"condition"`
+	Value       float64 `json:"value"`
+	Threshold   float64 `json:"threshold"`
+}
+
+// statsAlerts returns an alert for each threshold (that is enabled) that a
+// topic or channel in stats is over
+func statsAlerts(stats []TopicStats, opts *Options) []StatsAlert {
+	alerts := make([]StatsAlert, 0)
+	depthThreshold := float64(opts.AlertDepthThreshold)
+	ageThreshold := float64(opts.AlertAgeThreshold)
+	timeoutRateThreshold := opts.AlertTimeoutRateThreshold
+	for _, t := range stats {
+		if depthThreshold > 0 && float64(t.Depth) > depthThreshold {
+			alerts = append(alerts, StatsAlert{t.TopicName, "", "depth", float64(t.Depth), depthThreshold})
+		}
+		for _, c := range t.Channels {
+			if depthThreshold > 0 && float64(c.Depth) > depthThreshold {
+				alerts = append(alerts, StatsAlert{t.TopicName, c.ChannelName, "depth",
+					float64(c.Depth), depthThreshold})
+			}
+			if ageThreshold > 0 && float64(c.OldestInFlightAge) > ageThreshold {
+				alerts = append(alerts, StatsAlert{t.TopicName, c.ChannelName, "age",
+					float64(c.OldestInFlightAge), ageThreshold})
+			}
+			if timeoutRateThreshold > 0 && c.TimeoutRate > timeoutRateThreshold {
+				alerts = append(alerts, StatsAlert{t.TopicName, c.ChannelName, "timeout_rate",
+					c.TimeoutRate, timeoutRateThreshold})
+			}
+		}
+	}
+	return alerts
+}
+
+// alertsEnabled is whether any --alert-*-threshold is set
+func alertsEnabled(opts *Options) bool {
+	return opts.AlertDepthThreshold > 0 || opts.AlertAgeThreshold > 0 ||
+		opts.AlertTimeoutRateThreshold > 0
+}
@@ -0,0 +1,40 @@
+package nsqd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nsqio/nsq/internal/test"
+)
+
+func TestStatsAlerts(t *testing.T) {
+	stats := []TopicStats{
+		{
+			TopicName: "a",
+			Depth:     200,
+			Channels: []ChannelStats{
+				{ChannelName: "ch1", Depth: 50, OldestInFlightAge: int64(2 * time.Minute)},
+				{ChannelName: "ch2", Depth: 150, TimeoutRate: 0.5},
+			},
+		},
+		{TopicName: "b", Depth: 10},
+	}
+
+	opts := NewOptions()
+	test.Equal(t, false, alertsEnabled(opts))
+	test.Equal(t, []StatsAlert{}, statsAlerts(stats, opts))
+
+	opts.AlertDepthThreshold = 100
+	opts.AlertAgeThreshold = time.Minute
+	opts.AlertTimeoutRateThreshold = 1
+	test.Equal(t, true, alertsEnabled(opts))
+	test.Equal(t, []StatsAlert{
+		{"a", "", "depth", 200, 100},
+		{"a", "ch1", "age", float64(2 * time.Minute), float64(time.Minute)},
+		{"a", "ch2", "depth", 150, 100},
+	}, statsAlerts(stats, opts))
+
+	opts.AlertTimeoutRateThreshold = 0.1
+	alerts := statsAlerts(stats, opts)
+	test.Equal(t, StatsAlert{"a", "ch2", "timeout_rate", 0.5, 0.1}, alerts[len(alerts)-1])
+}
@@ -0,0 +1,177 @@
+package nsqd
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// a delta token refers to the stats values returned with it, they are kept
+// until they are statsDeltaTTL old or there are more than maxStatsDeltas
+// newer ones (a token can be used more than once until then), after that the
+// token is unknown and the next response is a reset
+const (
+	maxStatsDeltas = 64
+	statsDeltaTTL  = 5 * time.Minute
+)
+
+// statsValues are the numeric topic and channel stats, keyed by "<topic>" or
+// "<topic>:<channel>" and then the JSON field name
+type statsValues map[string]map[string]json.Number
+
+// StatsDelta is the change in statsValues since the baseline token, entities
+// (or fields) that are new since the baseline are relative to zero and
+// Deleted lists the entities that have gone away. Reset is true when there
+// was no (known) baseline and so Changes are the full values.
+type StatsDelta struct {
+	Token   string                            `json:"token"`
+	Reset   bool                              `json:"reset"`
+	Changes map[string]map[string]json.Number `json:"changes"`
+	Deleted []string                          `json:"deleted"`
+}
+
+type statsDeltaBaseline struct {
+	token     string
+	query     string
+	values    statsValues
+	createdAt time.Time
+}
+
+// statsDeltas keeps the baselines referred to by delta tokens, oldest first
+type statsDeltas struct {
+	sync.Mutex
+	seq       uint64
+	baselines []statsDeltaBaseline
+}
+
+func newStatsValues(stats []TopicStats) (statsValues, error) {
+	// round trip through JSON (preserving number precision), like
+	// filterStatsFields, so that the fields are named like the full output
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return nil, err
+	}
+	var topics []map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err = dec.Decode(&topics)
+	if err != nil {
+		return nil, err
+	}
+	values := make(statsValues)
+	for _, t := range topics {
+		topicName, _ := t["topic_name"].(string)
+		values[topicName] = numericFields(t)
+		channels, _ := t["channels"].([]interface{})
+		for _, c := range channels {
+			cm, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			channelName, _ := cm["channel_name"].(string)
+			values[topicName+":"+channelName] = numericFields(cm)
+		}
+	}
+	return values, nil
+}
+
+// numericFields returns the (top level) numbers in m, nested objects such as
+// clients and e2e latency are not included
+func numericFields(m map[string]interface{}) map[string]json.Number {
+	fields := make(map[string]json.Number)
+	for k, v := range m {
+		if n, ok := v.(json.Number); ok {
+			fields[k] = n
+		}
+	}
+	return fields
+}
+
+// diff returns the changed values of current relative to baseline (which may
+// be nil) and the entities that are only in baseline
+func (current statsValues) diff(baseline statsValues) (map[string]map[string]json.Number, []string) {
+	changes := make(map[string]map[string]json.Number)
+	for entity, fields := range current {
+		for k, v := range fields {
+			d, changed := numberDelta(baseline[entity][k], v)
+			if !changed {
+				continue
+			}
+			if changes[entity] == nil {
+				changes[entity] = make(map[string]json.Number)
+			}
+			changes[entity][k] = d
+		}
+	}
+	deleted := make([]string, 0)
+	for entity := range baseline {
+		if _, ok := current[entity]; !ok {
+			deleted = append(deleted, entity)
+		}
+	}
+	sort.Strings(deleted)
+	return changes, deleted
+}
+
+// numberDelta returns to - from (from may be empty, ie. zero), as an integer
+// when both are
+func numberDelta(from json.Number, to json.Number) (json.Number, bool) {
+	if from == to {
+		return "", false
+	}
+	if from == "" {
+		from = "0"
+	}
+	fromInt, fromErr := from.Int64()
+	toInt, toErr := to.Int64()
+	if fromErr == nil && toErr == nil {
+		d := toInt - fromInt
+		return json.Number(strconv.FormatInt(d, 10)), d != 0
+	}
+	fromFloat, _ := from.Float64()
+	toFloat, _ := to.Float64()
+	d := toFloat - fromFloat
+	return json.Number(strconv.FormatFloat(d, 'g', -1, 64)), d != 0
+}
+
+// delta returns current relative to the baseline of token (if it is known and
+// was for the same query) and stores current under a new token
+func (s *statsDeltas) delta(token string, query string, current statsValues, now time.Time) StatsDelta {
+	s.Lock()
+	defer s.Unlock()
+
+	// expire old baselines, they are kept in creation order
+	i := 0
+	for i < len(s.baselines) && now.Sub(s.baselines[i].createdAt) >= statsDeltaTTL {
+		i++
+	}
+	s.baselines = s.baselines[i:]
+
+	var baseline statsValues
+	reset := true
+	for _, b := range s.baselines {
+		if token != "" && b.token == token && b.query == query {
+			baseline = b.values
+			reset = false
+			break
+		}
+	}
+	changes, deleted := current.diff(baseline)
+
+	s.seq++
+	newToken := strconv.FormatUint(s.seq, 36) + "." + strconv.FormatInt(now.UnixNano(), 36)
+	s.baselines = append(s.baselines, statsDeltaBaseline{newToken, query, current, now})
+	if len(s.baselines) > maxStatsDeltas {
+		s.baselines = s.baselines[len(s.baselines)-maxStatsDeltas:]
+	}
+
+	return StatsDelta{
+		Token:   newToken,
+		Reset:   reset,
+		Changes: changes,
+		Deleted: deleted,
+	}
+}
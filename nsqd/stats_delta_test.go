@@ -0,0 +1,62 @@
+package nsqd
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nsqio/nsq/internal/test"
+)
+
+func TestStatsDelta(t *testing.T) {
+	var s statsDeltas
+	now := time.Now()
+
+	values, err := newStatsValues([]TopicStats{
+		{TopicName: "a", Depth: 10, MessageCount: 5, Channels: []ChannelStats{
+			{ChannelName: "ch", Depth: 3, DepthEWMA: 1.5},
+		}},
+		{TopicName: "b", Depth: 1},
+	})
+	test.Nil(t, err)
+	test.Equal(t, json.Number("10"), values["a"]["depth"])
+	test.Equal(t, json.Number("3"), values["a:ch"]["depth"])
+
+	// without a token everything is relative to zero
+	d := s.delta("", "", values, now)
+	test.Equal(t, true, d.Reset)
+	test.Equal(t, json.Number("10"), d.Changes["a"]["depth"])
+	test.Equal(t, json.Number("1.5"), d.Changes["a:ch"]["depth_ewma"])
+	test.Equal(t, 0, len(d.Deleted))
+	token := d.Token
+
+	values, err = newStatsValues([]TopicStats{
+		{TopicName: "a", Depth: 7, MessageCount: 5, Channels: []ChannelStats{
+			{ChannelName: "ch", Depth: 3, DepthEWMA: 2},
+		}},
+	})
+	test.Nil(t, err)
+	d = s.delta(token, "", values, now)
+	test.Equal(t, false, d.Reset)
+	test.Equal(t, json.Number("-3"), d.Changes["a"]["depth"])
+	_, ok := d.Changes["a"]["message_count"]
+	test.Equal(t, false, ok)
+	test.Equal(t, json.Number("0.5"), d.Changes["a:ch"]["depth_ewma"])
+	test.Equal(t, []string{"b"}, d.Deleted)
+	test.NotEqual(t, token, d.Token)
+
+	// a token can be reused, but not for a different query
+	test.Equal(t, false, s.delta(token, "", values, now).Reset)
+	test.Equal(t, true, s.delta(token, "a:", values, now).Reset)
+
+	// tokens expire
+	test.Equal(t, true, s.delta(token, "", values, now.Add(statsDeltaTTL)).Reset)
+
+	// and are evicted once there are too many newer ones
+	token = s.delta("", "", values, now).Token
+	for i := 0; i < maxStatsDeltas; i++ {
+		s.delta("", strconv.Itoa(i), values, now)
+	}
+	test.Equal(t, true, s.delta(token, "", values, now).Reset)
+}
@@ -0,0 +1,132 @@
+package nsqd
+
+import (
+	"sync"
+	"time"
+)
+
+// StatsHistoryPoint is the depths and counters of every topic and channel at
+// one point in time, clients are summarised as a count
+type StatsHistoryPoint struct {
+	Timestamp int64               `json:"timestamp"`
+	Topics    []TopicHistoryStats `json:"topics"`
+}
+
+type TopicHistoryStats struct {
+	TopicName    string                `json:"topic_name"`
+	Depth        int64                 `json:"depth"`
+	BackendDepth int64                 `json:"backend_depth"`
+	MessageCount uint64                `json:"message_count"`
+	Channels     []ChannelHistoryStats `json:"channels"`
+}
+
+type ChannelHistoryStats struct {
+	ChannelName   string `json:"channel_name"`
+	Depth         int64  `json:"depth"`
+	BackendDepth  int64  `json:"backend_depth"`
+	InFlightCount uint64 `json:"in_flight_count"`
+	DeferredCount uint64 `json:"deferred_count"`
+	MessageCount  uint64 `json:"message_count"`
+	RequeueCount  uint64 `json:"requeue_count"`
+	TimeoutCount  uint64 `json:"timeout_count"`
+	ClientCount   int    `json:"client_count"`
+}
+
+func newStatsHistoryPoint(stats []TopicStats, now time.Time) StatsHistoryPoint {
+	p := StatsHistoryPoint{
+		Timestamp: now.Unix(),
+		Topics:    make([]TopicHistoryStats, 0, len(stats)),
+	}
+	for _, t := range stats {
+		th := TopicHistoryStats{
+			TopicName:    t.TopicName,
+			Depth:        t.Depth,
+			BackendDepth: t.BackendDepth,
+			MessageCount: t.MessageCount,
+			Channels:     make([]ChannelHistoryStats, 0, len(t.Channels)),
+		}
+		for _, c := range t.Channels {
+			th.Channels = append(th.Channels, ChannelHistoryStats{
+				ChannelName:   c.ChannelName,
+				Depth:         c.Depth,
+				BackendDepth:  c.BackendDepth,
+				InFlightCount: c.InFlightCount,
+				DeferredCount: c.DeferredCount,
+				MessageCount:  c.MessageCount,
+				RequeueCount:  c.RequeueCount,
+				TimeoutCount:  c.TimeoutCount,
+				ClientCount:   len(c.Clients),
+			})
+		}
+		p.Topics = append(p.Topics, th)
+	}
+	return p
+}
+
+// filter returns a copy of p with only the given topic and/or channel (either
+// may be empty to keep all), like GetStats topics missing the channel are
+// dropped
+func (p StatsHistoryPoint) filter(topic string, channel string) StatsHistoryPoint {
+	filtered := StatsHistoryPoint{
+		Timestamp: p.Timestamp,
+		Topics:    make([]TopicHistoryStats, 0),
+	}
+	for _, t := range p.Topics {
+		if topic != "" && t.TopicName != topic {
+			continue
+		}
+		if channel != "" {
+			var channels []ChannelHistoryStats
+			for _, c := range t.Channels {
+				if c.ChannelName == channel {
+					channels = append(channels, c)
+				}
+			}
+			if len(channels) == 0 {
+				continue
+			}
+			t.Channels = channels
+		}
+		filtered.Topics = append(filtered.Topics, t)
+	}
+	return filtered
+}
+
+// statsHistory is a fixed size ring buffer of StatsHistoryPoint, once full
+// each new point replaces the oldest
+type statsHistory struct {
+	sync.Mutex
+	points []StatsHistoryPoint
+	next   int
+	count  int
+}
+
+func newStatsHistory(size int) *statsHistory {
+	return &statsHistory{
+		points: make([]StatsHistoryPoint, size),
+	}
+}
+
+func (h *statsHistory) add(p StatsHistoryPoint) {
+	h.Lock()
+	h.points[h.next] = p
+	h.next = (h.next + 1) % len(h.points)
+	if h.count < len(h.points) {
+		h.count++
+	}
+	h.Unlock()
+}
+
+// last returns (up to) the n most recent points, oldest first
+func (h *statsHistory) last(n int) []StatsHistoryPoint {
+	h.Lock()
+	defer h.Unlock()
+	if n > h.count {
+		n = h.count
+	}
+	points := make([]StatsHistoryPoint, 0, n)
+	for i := h.next - n; i < h.next; i++ {
+		points = append(points, h.points[(i+len(h.points))%len(h.points)])
+	}
+	return points
+}
@@ -0,0 +1,53 @@
+package nsqd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nsqio/nsq/internal/test"
+)
+
+func TestStatsHistory(t *testing.T) {
+	h := newStatsHistory(3)
+	test.Equal(t, 0, len(h.last(10)))
+
+	for i := int64(1); i <= 5; i++ {
+		h.add(StatsHistoryPoint{Timestamp: i})
+	}
+	points := h.last(10)
+	test.Equal(t, 3, len(points))
+	test.Equal(t, int64(3), points[0].Timestamp)
+	test.Equal(t, int64(5), points[2].Timestamp)
+
+	points = h.last(2)
+	test.Equal(t, 2, len(points))
+	test.Equal(t, int64(4), points[0].Timestamp)
+	test.Equal(t, int64(5), points[1].Timestamp)
+}
+
+func TestStatsHistoryPointFilter(t *testing.T) {
+	p := newStatsHistoryPoint([]TopicStats{
+		{TopicName: "a", Channels: []ChannelStats{
+			{ChannelName: "ch1", Depth: 1, Clients: []ClientStats{{}, {}}},
+			{ChannelName: "ch2", Depth: 2},
+		}},
+		{TopicName: "b", Channels: []ChannelStats{{ChannelName: "ch2", Depth: 3}}},
+	}, time.Unix(100, 0))
+	test.Equal(t, int64(100), p.Timestamp)
+	test.Equal(t, 2, p.Topics[0].Channels[0].ClientCount)
+
+	f := p.filter("a", "")
+	test.Equal(t, 1, len(f.Topics))
+	test.Equal(t, 2, len(f.Topics[0].Channels))
+
+	f = p.filter("", "ch2")
+	test.Equal(t, 2, len(f.Topics))
+	test.Equal(t, int64(2), f.Topics[0].Channels[0].Depth)
+	test.Equal(t, int64(3), f.Topics[1].Channels[0].Depth)
+
+	f = p.filter("b", "ch1")
+	test.Equal(t, 0, len(f.Topics))
+
+	// the original is not modified
+	test.Equal(t, 2, len(p.Topics[0].Channels))
+}
@@ -0,0 +1,73 @@
+package nsqd
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// StatsProfile is the time (in us) spent in each phase of the most recent
+// stats collection. Topics (and each topic's channels) are collected
+// concurrently, so the per-topic and per-channel phases are summed across
+// goroutines and can add up to more than TotalUsec.
+type StatsProfile struct {
+	CollectedTimestamp int64 `json:"collected_ts"`
+	TotalUsec          int64 `json:"total_usec"`
+	TopicCount         int   `json:"topic_count"`
+	ChannelCount       int   `json:"channel_count"`
+
+	// waiting for the NSQD read lock, then listing topics under it
+	NSQDLockUsec     int64 `json:"nsqd_lock_usec"`
+	TopicListUsec    int64 `json:"topic_list_usec"`
+	TopicLockUsec    int64 `json:"topic_lock_usec"`
+	ChannelLockUsec  int64 `json:"channel_lock_usec"`
+	ChannelStatsUsec int64 `json:"channel_stats_usec"`
+	// NewTopicStats, mostly aggregating the channels' e2e processing latency
+	TopicStatsUsec int64 `json:"topic_stats_usec"`
+}
+
+// statsProfiler accumulates (in ns) a StatsProfile during a collection, the
+// per-topic and per-channel phases are added to concurrently
+type statsProfiler struct {
+	nsqdLock     int64
+	topicList    int64
+	topicLock    int64
+	channelLock  int64
+	channelStats int64
+	topicStats   int64
+	channelCount int64
+
+	start time.Time
+}
+
+func (p *statsProfiler) add(phase *int64, d time.Duration) {
+	atomic.AddInt64(phase, int64(d))
+}
+
+// finish stores the profile of the collection (of topicCount topics) as the
+// one returned by GetStatsProfile
+func (p *statsProfiler) finish(n *NSQD, topicCount int) {
+	usec := func(phase *int64) int64 {
+		return atomic.LoadInt64(phase) / int64(time.Microsecond)
+	}
+	n.statsProfile.Store(StatsProfile{
+		CollectedTimestamp: p.start.UnixNano(),
+		TotalUsec:          int64(time.Since(p.start) / time.Microsecond),
+		TopicCount:         topicCount,
+		ChannelCount:       int(atomic.LoadInt64(&p.channelCount)),
+
+		NSQDLockUsec:     usec(&p.nsqdLock),
+		TopicListUsec:    usec(&p.topicList),
+		TopicLockUsec:    usec(&p.topicLock),
+		ChannelLockUsec:  usec(&p.channelLock),
+		ChannelStatsUsec: usec(&p.channelStats),
+		TopicStatsUsec:   usec(&p.topicStats),
+	})
+}
+
+// GetStatsProfile returns the phase timings of the most recent stats
+// collection (by /stats, statsd, the stats history etc.), the zero
+// StatsProfile before the first one
+func (n *NSQD) GetStatsProfile() StatsProfile {
+	profile, _ := n.statsProfile.Load().(StatsProfile)
+	return profile
+}
@@ -2,15 +2,24 @@ package nsqd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/golang/snappy"
 	"github.com/nsqio/nsq/internal/http_api"
+	"github.com/nsqio/nsq/internal/quantile"
 	"github.com/nsqio/nsq/internal/test"
 )
 
@@ -45,6 +54,11 @@ func TestStats(t *testing.T) {
 	test.Equal(t, 1, len(stats))
 	test.Equal(t, 1, len(stats[0].Channels))
 	test.Equal(t, 1, len(stats[0].Channels[0].Clients))
+	test.Equal(t, int64(0), stats[0].FirstConsumerDelay)
+
+	accompanyTopic.createdAt = time.Now().Add(-time.Minute)
+	stats = nsqd.GetStats(accompanyTopicName, "")
+	test.Equal(t, int64(60), stats[0].FirstConsumerDelay)
 
 	stats = nsqd.GetStats(topicName, "none_exist_channel")
 	t.Logf("stats: %+v", stats)
@@ -57,6 +71,36 @@ func TestStats(t *testing.T) {
 	test.Equal(t, 0, len(stats))
 }
 
+func TestOrphanChannelCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	tcpAddr, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_orphan_channel_count" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	topic.GetChannel("orphan")
+	nsqd.GetTopic("other").GetChannel("orphan")
+
+	conn, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	identify(t, conn, nil, frameTypeResponse)
+	sub(t, conn, topicName, "ch")
+	test.Equal(t, 1, NewTopicStats(topic, nil, false).OrphanChannelCount)
+	test.Equal(t, 2, nsqd.GetOrphanChannelCount())
+
+	// a channel whose consumers have gone away is not an orphan
+	conn.Close()
+	for i := 0; len(nsqd.GetStats(topicName, "ch")[0].Channels[0].Clients) > 0; i++ {
+		if i > 100 {
+			t.Fatal("client was not removed from channel")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.Equal(t, 2, nsqd.GetOrphanChannelCount())
+}
+
 func TestClientAttributes(t *testing.T) {
 	userAgent := "Test User Agent"
 
@@ -95,11 +139,16 @@ func TestClientAttributes(t *testing.T) {
 		Topics []struct {
 			Channels []struct {
 				Clients []struct {
-					UserAgent string `json:"user_agent"`
-					Snappy    bool   `json:"snappy"`
+					UserAgent            string `json:"user_agent"`
+					Snappy               bool   `json:"snappy"`
+					LastCommand          string `json:"last_command"`
+					LastCommandTimestamp int64  `json:"last_command_ts"`
+					Topic                string `json:"topic"`
+					Channel              string `json:"channel"`
 				} `json:"clients"`
 			} `json:"channels"`
 		} `json:"topics"`
+		ClientVersions map[string]int `json:"client_versions"`
 	}
 
 	endpoint := fmt.Sprintf("http://127.0.0.1:%d/stats?format=json", httpAddr.Port)
@@ -108,6 +157,374 @@ func TestClientAttributes(t *testing.T) {
 
 	test.Equal(t, userAgent, d.Topics[0].Channels[0].Clients[0].UserAgent)
 	test.Equal(t, true, d.Topics[0].Channels[0].Clients[0].Snappy)
+	test.Equal(t, "SUB", d.Topics[0].Channels[0].Clients[0].LastCommand)
+	test.Equal(t, topicName, d.Topics[0].Channels[0].Clients[0].Topic)
+	test.Equal(t, "ch", d.Topics[0].Channels[0].Clients[0].Channel)
+	test.NotEqual(t, int64(0), d.Topics[0].Channels[0].Clients[0].LastCommandTimestamp)
+	test.Equal(t, map[string]int{userAgent: 1}, d.ClientVersions)
+
+	// connections are counted until they close, IDENTIFYed or not
+	conn2, err := mustConnectNSQD(tcpAddr)
+	test.Nil(t, err)
+	for i := 0; i < 100 && len(nsqd.GetClientVersions()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.Equal(t, map[string]int{userAgent: 1, "V2": 1}, nsqd.GetClientVersions())
+	conn.Close()
+	conn2.Close()
+	for i := 0; i < 100 && len(nsqd.GetClientVersions()) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.Equal(t, map[string]int{}, nsqd.GetClientVersions())
+}
+
+func TestRecordCommand(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	client := newClientV2(0, nil, &context{nsqd})
+	client.recordCommand([]byte("RDY"))
+	test.Equal(t, "RDY", client.lastCommand)
+	client.recordCommand([]byte(strings.Repeat("X", 100)))
+	test.Equal(t, maxLastCommandLength, len(client.lastCommand))
+}
+
+func TestClientWriteErrorCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	conn, peer := net.Pipe()
+	peer.Close()
+	defer conn.Close()
+
+	client := newClientV2(0, conn, &context{nsqd})
+	client.Writer.Write([]byte("test"))
+	test.NotNil(t, client.Flush())
+	test.Equal(t, uint64(1), client.Stats().WriteErrorCount)
+}
+
+func TestClientMissedHeartbeatCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	defer conn.Close()
+
+	client := newClientV2(0, conn, &context{nsqd})
+	now := time.Now()
+	client.recordHeartbeat(now)
+	test.Equal(t, uint64(0), client.Stats().MissedHeartbeatCount)
+
+	// nothing received since the first heartbeat
+	now = now.Add(time.Second)
+	client.recordHeartbeat(now)
+	test.Equal(t, uint64(1), client.Stats().MissedHeartbeatCount)
+
+	// answered (by a NOP) before the next one
+	atomic.StoreInt64(&client.lastCommandAt, now.Add(time.Millisecond).UnixNano())
+	client.recordHeartbeat(now.Add(time.Second))
+	test.Equal(t, uint64(1), client.Stats().MissedHeartbeatCount)
+}
+
+func TestClientBufferedStats(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	go io.Copy(ioutil.Discard, peer)
+
+	p := &protocolV2{ctx: &context{nsqd}}
+	client := newClientV2(0, conn, &context{nsqd})
+	for i := 0; i < 2; i++ {
+		err := p.Send(client, frameTypeMessage, []byte("test"))
+		test.Nil(t, err)
+	}
+	stats := client.Stats()
+	test.Equal(t, 2, stats.BufferedMessageCount)
+	test.Equal(t, 2*(8+len("test")), stats.BufferedBytes)
+
+	err := client.Flush()
+	test.Nil(t, err)
+	stats = client.Stats()
+	test.Equal(t, 0, stats.BufferedMessageCount)
+	test.Equal(t, 0, stats.BufferedBytes)
+}
+
+func TestDeliverySkew(t *testing.T) {
+	clients := func(counts ...uint64) []ClientStats {
+		var cs []ClientStats
+		for _, n := range counts {
+			cs = append(cs, ClientStats{MessageCount: n})
+		}
+		return cs
+	}
+
+	test.Equal(t, float64(0), deliverySkew(nil))
+	test.Equal(t, float64(0), deliverySkew(clients(10)))
+	test.Equal(t, float64(0), deliverySkew(clients(0, 0)))
+	test.Equal(t, float64(1), deliverySkew(clients(10, 10, 10)))
+	test.Equal(t, float64(4), deliverySkew(clients(5, 20, 10)))
+	test.Equal(t, float64(20), deliverySkew(clients(0, 20)))
+}
+
+func TestUniqueClientHosts(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topic := nsqd.GetTopic("test")
+	ch1 := NewChannelStats(topic.GetChannel("ch1"),
+		[]ClientStats{{Hostname: "a"}, {Hostname: "b"}, {Hostname: "a"}}, false)
+	ch2 := NewChannelStats(topic.GetChannel("ch2"),
+		[]ClientStats{{Hostname: "b"}, {Hostname: "c"}}, false)
+	test.Equal(t, 2, ch1.UniqueClientHosts)
+	test.Equal(t, 2, ch2.UniqueClientHosts)
+	test.Equal(t, 3, NewTopicStats(topic, []ChannelStats{ch1, ch2}, false).UniqueClientHosts)
+	test.Equal(t, 0, NewTopicStats(topic, nil, false).UniqueClientHosts)
+}
+
+func TestBackedUpChannelCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topic := nsqd.GetTopic("test")
+	channels := []ChannelStats{{Depth: 3}, {Depth: 0}, {Depth: 1}}
+	test.Equal(t, 2, NewTopicStats(topic, channels, false).BackedUpChannelCount)
+	test.Equal(t, 0, NewTopicStats(topic, nil, false).BackedUpChannelCount)
+}
+
+func TestClientQualityScore(t *testing.T) {
+	opts := NewOptions()
+	now := time.Now()
+	active := ClientStats{LastCommandTimestamp: now.UnixNano()}
+
+	test.Equal(t, float64(1), clientQualityScore(active, 0, opts, now))
+
+	// idle for half of --client-timeout
+	cs := ClientStats{LastCommandTimestamp: now.Add(-opts.ClientTimeout / 2).UnixNano()}
+	test.Equal(t, 0.875, clientQualityScore(cs, 0, opts, now))
+
+	cs = active
+	cs.WriteErrorCount = 1
+	test.Equal(t, 0.875, clientQualityScore(cs, 0, opts, now))
+
+	// RDY fully used, with half of the in-flight messages near their timeout
+	cs = active
+	cs.ReadyCount = 4
+	cs.InFlightCount = 4
+	test.Equal(t, 0.625, clientQualityScore(cs, 2, opts, now))
+
+	// only RDY utilization counts
+	opts.QualityScoreIdleWeight = 0
+	opts.QualityScoreWriteErrorWeight = 0
+	opts.QualityScoreNearTimeoutWeight = 0
+	cs.InFlightCount = 1
+	test.Equal(t, 0.75, clientQualityScore(cs, 1, opts, now))
+}
+
+func TestNearTimeoutInFlightCounts(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topic := nsqd.GetTopic("test")
+	channel := topic.GetChannel("ch")
+	for i := 0; i < 3; i++ {
+		msg := NewMessage(topic.GenerateID(), []byte("test"))
+		channel.StartInFlightTimeout(msg, int64(i%2), time.Minute)
+	}
+	test.Equal(t, 0, len(channel.inFlightStats(time.Now()).nearTimeout))
+
+	counts := channel.inFlightStats(time.Now().Add(50 * time.Second)).nearTimeout
+	test.Equal(t, int64(2), counts[0])
+	test.Equal(t, int64(1), counts[1])
+
+	now := time.Now().Add(2 * time.Minute)
+	inFlight := channel.inFlightStats(now)
+	test.Equal(t, int64(3), inFlight.overdue)
+	if age := inFlight.oldestAge(now); age < int64(2*time.Minute) {
+		t.Fatalf("oldest in-flight age %v less than time since publish", age)
+	}
+	test.Equal(t, int64(0), inFlightSnapshot{}.oldestAge(now))
+}
+
+func TestDeferredRatio(t *testing.T) {
+	test.Equal(t, float64(0), deferredRatio(5, 0))
+	test.Equal(t, float64(0), deferredRatio(0, 10))
+	test.Equal(t, 0.5, deferredRatio(5, 10))
+	test.Equal(t, float64(2), deferredRatio(20, 10))
+}
+
+func TestSortAndLimitClients(t *testing.T) {
+	stats := []TopicStats{{Channels: []ChannelStats{
+		{Clients: []ClientStats{
+			{ClientID: "a", InFlightCount: 1, ConnectTime: 30},
+			{ClientID: "b", InFlightCount: 5, ConnectTime: 10},
+			{ClientID: "c", InFlightCount: 3, ConnectTime: 20},
+		}},
+		{Clients: []ClientStats{
+			{ClientID: "d", InFlightCount: 1},
+		}},
+	}}}
+
+	sortAndLimitClients(stats, "in_flight_count", 2)
+	clients := stats[0].Channels[0].Clients
+	test.Equal(t, 2, len(clients))
+	test.Equal(t, "b", clients[0].ClientID)
+	test.Equal(t, "c", clients[1].ClientID)
+	test.Equal(t, true, stats[0].Channels[0].ClientsTruncated)
+	test.Equal(t, 1, len(stats[0].Channels[1].Clients))
+	test.Equal(t, false, stats[0].Channels[1].ClientsTruncated)
+
+	sortAndLimitClients(stats, "connect_ts", 0)
+	clients = stats[0].Channels[0].Clients
+	test.Equal(t, "b", clients[0].ClientID)
+	test.Equal(t, "c", clients[1].ClientID)
+}
+
+func TestSetClientMessageCounts(t *testing.T) {
+	stats := []TopicStats{{Channels: []ChannelStats{
+		{Clients: []ClientStats{
+			{ClientID: "a", MessageCount: 3},
+			{ClientID: "b", MessageCount: 7},
+		}},
+		{},
+	}}}
+
+	setClientMessageCounts(stats)
+	sortAndLimitClients(stats, "message_count", 1)
+	test.Equal(t, map[string]uint64{"a": 3, "b": 7}, stats[0].Channels[0].ClientMessageCounts)
+	test.Equal(t, 0, len(stats[0].Channels[1].ClientMessageCounts))
+}
+
+func TestRoundStatsQuantiles(t *testing.T) {
+	result := func(values ...float64) *quantile.Result {
+		r := &quantile.Result{Count: len(values)}
+		for _, v := range values {
+			r.Percentiles = append(r.Percentiles, map[string]float64{"quantile": 0.99, "value": v})
+		}
+		return r
+	}
+	stats := []TopicStats{{
+		E2eProcessingLatency: result(1234567.891),
+		Channels: []ChannelStats{{
+			E2eProcessingLatency: result(0.000123456, 0),
+			DwellTime:            result(98765.4321),
+		}},
+	}}
+
+	roundStatsQuantiles(stats, 3)
+	test.Equal(t, float64(1230000), stats[0].E2eProcessingLatency.Percentiles[0]["value"])
+	test.Equal(t, 0.99, stats[0].E2eProcessingLatency.Percentiles[0]["quantile"])
+	test.Equal(t, 0.000123, stats[0].Channels[0].E2eProcessingLatency.Percentiles[0]["value"])
+	test.Equal(t, float64(0), stats[0].Channels[0].E2eProcessingLatency.Percentiles[1]["value"])
+	test.Equal(t, float64(98800), stats[0].Channels[0].DwellTime.Percentiles[0]["value"])
+}
+
+// syncedBackendQueue is a stand-in for a disk-backed queue
+type syncedBackendQueue struct {
+	dummyBackendQueue
+}
+
+func TestBackendSyncStats(t *testing.T) {
+	opts := NewOptions()
+
+	syncEvery, syncTimeout := backendSyncStats(newDummyBackendQueue(), opts)
+	test.Equal(t, int64(0), syncEvery)
+	test.Equal(t, int64(0), syncTimeout)
+
+	syncEvery, syncTimeout = backendSyncStats(&syncedBackendQueue{}, opts)
+	test.Equal(t, opts.SyncEvery, syncEvery)
+	test.Equal(t, int64(opts.SyncTimeout), syncTimeout)
+}
+
+func TestTotalBackendBytes(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	for name, size := range map[string]int{
+		"test.diskqueue.000000.dat":    100,
+		"test:ch.diskqueue.000003.dat": 20,
+		"test.diskqueue.meta.dat":      50,
+		"unrelated.dat":                50,
+	} {
+		err := ioutil.WriteFile(filepath.Join(opts.DataPath, name), make([]byte, size), 0600)
+		test.Nil(t, err)
+	}
+	test.Equal(t, int64(120), nsqd.GetTotalBackendBytes())
+}
+
+func TestProcessRSSBytes(t *testing.T) {
+	rss, err := processRSSBytes()
+	if runtime.GOOS != "linux" {
+		test.NotNil(t, err)
+		return
+	}
+	test.Nil(t, err)
+	test.Equal(t, true, rss > 0)
+	test.Equal(t, rss > 0, getMemStats().ProcessRSSBytes > 0)
+}
+
+func TestGCTotalPauseUsec(t *testing.T) {
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	runtime.GC()
+	ms := getMemStats()
+	test.Equal(t, true, ms.GCTotalPauseUsec >= before.PauseTotalNs/1000)
+	test.Equal(t, true, ms.GCTotalRuns > before.NumGC)
+}
+
+func TestFanoutRatio(t *testing.T) {
+	test.Equal(t, float64(0), fanoutRatio(nil, 0))
+	test.Equal(t, float64(0), fanoutRatio(nil, 10))
+	channels := []ChannelStats{{MessageCount: 10}, {MessageCount: 10}, {MessageCount: 5}}
+	test.Equal(t, 2.5, fanoutRatio(channels, 10))
+}
+
+func TestLastError(t *testing.T) {
+	var e lastError
+	msg, at := e.get()
+	test.Equal(t, "", msg)
+	test.Equal(t, int64(0), at)
+
+	e.set(nil)
+	msg, _ = e.get()
+	test.Equal(t, "", msg)
+
+	e.set(errors.New("backend write failed"))
+	msg, at = e.get()
+	test.Equal(t, "backend write failed", msg)
+	test.Equal(t, true, at > 0)
+
+	// truncated without splitting the multi-byte rune at the limit
+	e.set(errors.New(strings.Repeat("a", maxLastErrorLength-1) + "\u00e9"))
+	msg, _ = e.get()
+	test.Equal(t, strings.Repeat("a", maxLastErrorLength-1), msg)
 }
 
 func TestStatsChannelLocking(t *testing.T) {
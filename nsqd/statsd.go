@@ -124,6 +124,8 @@ func (n *NSQD) statsdLoop() {
 				client.Gauge("mem.gc_pause_usec_95", int64(ms.GCPauseUsec95))
 				client.Gauge("mem.next_gc_bytes", int64(ms.NextGCBytes))
 				client.Incr("mem.gc_runs", int64(ms.GCTotalRuns-lastMemStats.GCTotalRuns))
+				client.Incr("mem.gc_pause_usec", int64(ms.GCTotalPauseUsec-lastMemStats.GCTotalPauseUsec))
+				client.Gauge("mem.process_rss_bytes", ms.ProcessRSSBytes)
 
 				lastMemStats = ms
 			}
@@ -3,6 +3,7 @@ package nsqd
 import (
 	"io"
 	"net"
+	"sync/atomic"
 
 	"github.com/nsqio/nsq/internal/protocol"
 )
@@ -14,6 +15,10 @@ type tcpServer struct {
 func (p *tcpServer) Handle(clientConn net.Conn) {
 	p.ctx.nsqd.logf(LOG_INFO, "TCP: new client(%s)", clientConn.RemoteAddr())
 
+	atomic.AddInt64(&p.ctx.nsqd.clientCount, 1)
+	defer atomic.AddInt64(&p.ctx.nsqd.clientCount, -1)
+	atomic.AddUint64(&p.ctx.nsqd.acceptedConnectionCount, 1)
+
 	// The client should initialize itself by sending a 4 byte sequence indicating
 	// the version of the protocol that it intends to communicate, this will allow us
 	// to gracefully upgrade the protocol away from text/line oriented to whatever...
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/nsqio/go-diskqueue"
+	"github.com/nsqio/nsq/internal/ewma"
 	"github.com/nsqio/nsq/internal/lg"
 	"github.com/nsqio/nsq/internal/quantile"
 	"github.com/nsqio/nsq/internal/util"
@@ -16,7 +17,44 @@ import (
 
 type Topic struct {
 	// 64bit atomic vars need to be first for proper alignment on 32bit platforms
-	messageCount uint64
+	messageCount      uint64
+	messageBytes      uint64
+	maxMessageSize    int64
+	memQueueFullCount uint64
+	mpubCount         uint64
+	mpubMessageCount  uint64
+	maxMPubBatchSize  int64
+	pausedAt          int64
+	firstConsumerAt   int64
+
+	// messages published with a defer (DPUB, /pub?defer=) and the longest defer
+	deferredPublishCount uint64
+	maxPublishDeferred   int64
+
+	// channels created since startup, including since deleted ones
+	channelsCreated uint64
+
+	// messages published while the topic was paused
+	publishedWhilePausedCount uint64
+
+	// messages published over HTTP (/pub, /mpub) and TCP (PUB, MPUB, DPUB)
+	httpPublishCount uint64
+	tcpPublishCount  uint64
+
+	// successful PUB, MPUB and DPUB commands
+	pubCommandCount  uint64
+	mpubCommandCount uint64
+	dpubCommandCount uint64
+
+	// time (in ns) of the most recently published message
+	lastMessageAt int64
+
+	// depths as of the last sampleDepth, used by approximate stats
+	sampledDepth        int64
+	sampledBackendDepth int64
+
+	// size (see messageSize) of the messages in memoryMsgChan
+	memoryBytes int64
 
 	sync.RWMutex
 
@@ -37,6 +75,18 @@ type Topic struct {
 	paused    int32
 	pauseChan chan bool
 
+	createdAt time.Time
+
+	// smoothed bytes/sec published to this topic
+	byteRate *ewma.Rate
+
+	lastError lastError
+
+	// e2e processing latency window overrides (guarded by the RWMutex), zero
+	// means use --e2e-processing-latency-window-time with 2 sub-windows
+	e2eWindowTime time.Duration
+	e2eSubWindows int
+
 	ctx *context
 }
 
@@ -52,6 +102,8 @@ func NewTopic(topicName string, ctx *context, deleteCallback func(*Topic)) *Topi
 		pauseChan:         make(chan bool),
 		deleteCallback:    deleteCallback,
 		idFactory:         NewGUIDFactory(ctx.nsqd.getOpts().ID),
+		createdAt:         time.Now(),
+		byteRate:          ewma.NewRate(time.Minute),
 	}
 
 	if strings.HasSuffix(topicName, "#ephemeral") {
@@ -113,7 +165,11 @@ func (t *Topic) getOrCreateChannel(channelName string) (*Channel, bool) {
 			t.DeleteExistingChannel(c.name)
 		}
 		channel = NewChannel(t.name, channelName, t.ctx, deleteCallback)
+		if t.e2eSubWindows > 0 {
+			channel.e2eProcessingLatencyStream.SetWindow(t.e2eWindowTime, t.e2eSubWindows)
+		}
 		t.channelMap[channelName] = channel
+		atomic.AddUint64(&t.channelsCreated, 1)
 		t.ctx.nsqd.logf(LOG_INFO, "TOPIC(%s): new channel(%s)", t.name, channel.name)
 		return channel, true
 	}
@@ -173,7 +229,16 @@ func (t *Topic) PutMessage(m *Message) error {
 	if err != nil {
 		return err
 	}
+	t.recordMessageSize(len(m.Body))
 	atomic.AddUint64(&t.messageCount, 1)
+	atomic.StoreInt64(&t.lastMessageAt, time.Now().UnixNano())
+	if t.IsPaused() {
+		atomic.AddUint64(&t.publishedWhilePausedCount, 1)
+	}
+	if m.deferred > 0 {
+		atomic.AddUint64(&t.deferredPublishCount, 1)
+		atomicMaxInt64(&t.maxPublishDeferred, int64(m.deferred))
+	}
 	return nil
 }
 
@@ -189,20 +254,51 @@ func (t *Topic) PutMessages(msgs []*Message) error {
 		if err != nil {
 			return err
 		}
+		t.recordMessageSize(len(m.Body))
 	}
 	atomic.AddUint64(&t.messageCount, uint64(len(msgs)))
+	atomic.StoreInt64(&t.lastMessageAt, time.Now().UnixNano())
+	if t.IsPaused() {
+		atomic.AddUint64(&t.publishedWhilePausedCount, uint64(len(msgs)))
+	}
+	atomic.AddUint64(&t.mpubCount, 1)
+	atomic.AddUint64(&t.mpubMessageCount, uint64(len(msgs)))
+	atomicMaxInt64(&t.maxMPubBatchSize, int64(len(msgs)))
 	return nil
 }
 
+// recordMessageSize tracks the running total, rate and max of message body sizes
+func (t *Topic) recordMessageSize(size int) {
+	atomic.AddUint64(&t.messageBytes, uint64(size))
+	t.byteRate.Update(int64(size))
+	atomicMaxInt64(&t.maxMessageSize, int64(size))
+}
+
+// atomicMaxInt64 stores v in addr if it is larger than the current value
+func atomicMaxInt64(addr *int64, v int64) {
+	for {
+		max := atomic.LoadInt64(addr)
+		if v <= max || atomic.CompareAndSwapInt64(addr, max, v) {
+			return
+		}
+	}
+}
+
 func (t *Topic) put(m *Message) error {
+	// added first (and taken back if it does not fit) so that messagePump
+	// never takes it below zero
+	atomic.AddInt64(&t.memoryBytes, messageSize(m))
 	select {
 	case t.memoryMsgChan <- m:
 	default:
+		atomic.AddInt64(&t.memoryBytes, -messageSize(m))
+		atomic.AddUint64(&t.memQueueFullCount, 1)
 		b := bufferPoolGet()
 		err := writeMessageToBackend(b, m, t.backend)
 		bufferPoolPut(b)
 		t.ctx.nsqd.SetHealth(err)
 		if err != nil {
+			t.lastError.set(err)
 			t.ctx.nsqd.logf(LOG_ERROR,
 				"TOPIC(%s) ERROR: failed to write message to backend - %s",
 				t.name, err)
@@ -216,6 +312,24 @@ func (t *Topic) Depth() int64 {
 	return int64(len(t.memoryMsgChan)) + t.backend.Depth()
 }
 
+// sampleDepth caches the current depths for approximate stats, it is only
+// called from depthSampleLoop
+func (t *Topic) sampleDepth() {
+	backendDepth := t.backend.Depth()
+	atomic.StoreInt64(&t.sampledDepth, int64(len(t.memoryMsgChan))+backendDepth)
+	atomic.StoreInt64(&t.sampledBackendDepth, backendDepth)
+}
+
+// depths returns the total and backend depth, either exactly or as of the last
+// sampleDepth (at most depthSampleInterval old, zero before the first sample)
+func (t *Topic) depths(approximate bool) (int64, int64) {
+	if approximate {
+		return atomic.LoadInt64(&t.sampledDepth), atomic.LoadInt64(&t.sampledBackendDepth)
+	}
+	backendDepth := t.backend.Depth()
+	return int64(len(t.memoryMsgChan)) + backendDepth, backendDepth
+}
+
 // messagePump selects over the in-memory and backend queue and
 // writes messages to every channel for this topic
 func (t *Topic) messagePump() {
@@ -240,9 +354,11 @@ func (t *Topic) messagePump() {
 	for {
 		select {
 		case msg = <-memoryMsgChan:
+			atomic.AddInt64(&t.memoryBytes, -messageSize(msg))
 		case buf = <-backendChan:
 			msg, err = decodeMessage(buf)
 			if err != nil {
+				t.lastError.set(err)
 				t.ctx.nsqd.logf(LOG_ERROR, "failed to decode message - %s", err)
 				continue
 			}
@@ -291,6 +407,7 @@ func (t *Topic) messagePump() {
 			}
 			err := channel.PutMessage(chanMsg)
 			if err != nil {
+				t.lastError.set(err)
 				t.ctx.nsqd.logf(LOG_ERROR,
 					"TOPIC(%s) ERROR: failed to put msg(%s) to channel(%s) - %s",
 					t.name, msg.ID, channel.name, err)
@@ -362,7 +479,8 @@ func (t *Topic) exit(deleted bool) error {
 func (t *Topic) Empty() error {
 	for {
 		select {
-		case <-t.memoryMsgChan:
+		case msg := <-t.memoryMsgChan:
+			atomic.AddInt64(&t.memoryBytes, -messageSize(msg))
 		default:
 			goto finish
 		}
@@ -384,8 +502,10 @@ func (t *Topic) flush() error {
 	for {
 		select {
 		case msg := <-t.memoryMsgChan:
+			atomic.AddInt64(&t.memoryBytes, -messageSize(msg))
 			err := writeMessageToBackend(&msgBuf, msg, t.backend)
 			if err != nil {
+				t.lastError.set(err)
 				t.ctx.nsqd.logf(LOG_ERROR,
 					"ERROR: failed to write message to backend - %s", err)
 			}
@@ -411,8 +531,8 @@ func (t *Topic) AggregateChannelE2eProcessingLatency() *quantile.Quantile {
 			continue
 		}
 		if latencyStream == nil {
-			latencyStream = quantile.New(
-				t.ctx.nsqd.getOpts().E2EProcessingLatencyWindowTime,
+			windowTime, subWindows := t.E2eProcessingLatencyWindow()
+			latencyStream = quantile.NewWithSubWindows(windowTime, subWindows,
 				t.ctx.nsqd.getOpts().E2EProcessingLatencyPercentiles)
 		}
 		latencyStream.Merge(c.e2eProcessingLatencyStream)
@@ -420,6 +540,34 @@ func (t *Topic) AggregateChannelE2eProcessingLatency() *quantile.Quantile {
 	return latencyStream
 }
 
+// E2eProcessingLatencyWindow returns the effective e2e processing latency
+// window and number of sub-windows for this topic's channels
+func (t *Topic) E2eProcessingLatencyWindow() (time.Duration, int) {
+	t.RLock()
+	defer t.RUnlock()
+	if t.e2eSubWindows > 0 {
+		return t.e2eWindowTime, t.e2eSubWindows
+	}
+	return t.ctx.nsqd.getOpts().E2EProcessingLatencyWindowTime, 2
+}
+
+// SetE2eProcessingLatencyWindow overrides the e2e processing latency window
+// for this topic's (existing and future) channels, resetting their samples
+func (t *Topic) SetE2eProcessingLatencyWindow(windowTime time.Duration, subWindows int) {
+	t.Lock()
+	t.e2eWindowTime = windowTime
+	t.e2eSubWindows = subWindows
+	realChannels := make([]*Channel, 0, len(t.channelMap))
+	for _, c := range t.channelMap {
+		realChannels = append(realChannels, c)
+	}
+	t.Unlock()
+
+	for _, c := range realChannels {
+		c.e2eProcessingLatencyStream.SetWindow(windowTime, subWindows)
+	}
+}
+
 func (t *Topic) Pause() error {
 	return t.doPause(true)
 }
@@ -431,8 +579,10 @@ func (t *Topic) UnPause() error {
 func (t *Topic) doPause(pause bool) error {
 	if pause {
 		atomic.StoreInt32(&t.paused, 1)
+		atomic.CompareAndSwapInt64(&t.pausedAt, 0, time.Now().UnixNano())
 	} else {
 		atomic.StoreInt32(&t.paused, 0)
+		atomic.StoreInt64(&t.pausedAt, 0)
 	}
 
 	select {
@@ -443,6 +593,42 @@ func (t *Topic) doPause(pause bool) error {
 	return nil
 }
 
+// isQuiet returns whether the topic has not received a message (or, if it has
+// never received one, been created) for longer than threshold, it is never
+// quiet when threshold is 0
+func (t *Topic) isQuiet(threshold time.Duration, now time.Time) bool {
+	if threshold <= 0 {
+		return false
+	}
+	last := t.createdAt
+	if lastMessageAt := atomic.LoadInt64(&t.lastMessageAt); lastMessageAt != 0 {
+		last = time.Unix(0, lastMessageAt)
+	}
+	return now.Sub(last) > threshold
+}
+
+// orphanChannelCount returns the number of channels that have never had a
+// client
+func (t *Topic) orphanChannelCount() int {
+	var n int
+	t.RLock()
+	for _, c := range t.channelMap {
+		if atomic.LoadInt32(&c.hadClient) == 0 {
+			n++
+		}
+	}
+	t.RUnlock()
+	return n
+}
+
+// recordConsumer notes the time the first client subscribed to (any channel of)
+// the topic
+func (t *Topic) recordConsumer() {
+	if atomic.LoadInt64(&t.firstConsumerAt) == 0 {
+		atomic.CompareAndSwapInt64(&t.firstConsumerAt, 0, time.Now().UnixNano())
+	}
+}
+
 func (t *Topic) IsPaused() bool {
 	return atomic.LoadInt32(&t.paused) == 1
 }
@@ -451,6 +637,7 @@ func (t *Topic) GenerateID() MessageID {
 retry:
 	id, err := t.idFactory.NewGUID()
 	if err != nil {
+		atomic.AddUint64(&t.ctx.nsqd.guidErrorCount, 1)
 		time.Sleep(time.Millisecond)
 		goto retry
 	}
@@ -132,6 +132,8 @@ func TestDeletes(t *testing.T) {
 
 	channel2 := topic.GetChannel("ch2")
 	test.NotNil(t, channel2)
+	topic.GetChannel("ch2")
+	test.Equal(t, uint64(2), NewTopicStats(topic, nil, false).TotalChannelsCreated)
 
 	err = nsqd.DeleteExistingTopic("test")
 	test.Nil(t, err)
@@ -195,6 +197,209 @@ func TestPause(t *testing.T) {
 	test.Equal(t, int64(1), channel.Depth())
 }
 
+func TestPausedDuration(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_paused_duration" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	channel := topic.GetChannel("ch")
+
+	stats := nsqd.GetStats(topicName, "")
+	test.Equal(t, int64(0), stats[0].PausedAt)
+	test.Equal(t, int64(0), stats[0].PausedDuration)
+
+	topic.Pause()
+	channel.Pause()
+	pausedAt := time.Now().Add(-10 * time.Second)
+	topic.pausedAt = pausedAt.UnixNano()
+	channel.pausedAt = pausedAt.UnixNano()
+
+	// pausing again does not reset the timestamp
+	topic.Pause()
+	channel.Pause()
+
+	stats = nsqd.GetStats(topicName, "")
+	test.Equal(t, pausedAt.Unix(), stats[0].PausedAt)
+	test.Equal(t, int64(10), stats[0].PausedDuration)
+	test.Equal(t, pausedAt.Unix(), stats[0].Channels[0].PausedAt)
+	test.Equal(t, int64(10), stats[0].Channels[0].PausedDuration)
+
+	topic.UnPause()
+	channel.UnPause()
+
+	stats = nsqd.GetStats(topicName, "")
+	test.Equal(t, int64(0), stats[0].PausedDuration)
+	test.Equal(t, int64(0), stats[0].Channels[0].PausedDuration)
+}
+
+func TestPublishedWhilePausedCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_published_while_paused" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+
+	topic.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	topic.Pause()
+	topic.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	topic.PutMessages([]*Message{
+		NewMessage(topic.GenerateID(), []byte("test")),
+		NewMessage(topic.GenerateID(), []byte("test")),
+	})
+	topic.UnPause()
+	topic.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+
+	stats := nsqd.GetStats(topicName, "")
+	test.Equal(t, uint64(3), stats[0].PublishedWhilePausedCount)
+}
+
+func TestGUIDErrorCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_guid_error_count" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	topic.GenerateID()
+	test.Equal(t, uint64(0), nsqd.GetGUIDErrorCount())
+
+	// the clock appears to have gone backwards until it catches up
+	topic.idFactory.Lock()
+	topic.idFactory.lastTimestamp = (time.Now().UnixNano() >> 20) + 2
+	topic.idFactory.Unlock()
+	topic.GenerateID()
+	test.Equal(t, true, nsqd.GetGUIDErrorCount() > 0)
+}
+
+func TestTopicMemoryDepthBytes(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_topic_memory_depth_bytes" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+	topic.Pause()
+	topic.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+
+	stats := nsqd.GetStats(topicName, "")
+	test.Equal(t, int64(minValidMsgLength+len("test")), stats[0].MemoryDepthBytes)
+
+	topic.Empty()
+	stats = nsqd.GetStats(topicName, "")
+	test.Equal(t, int64(0), stats[0].MemoryDepthBytes)
+}
+
+func TestHasBackend(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	test.Equal(t, true, NewTopicStats(nsqd.GetTopic("test"), nil, false).HasBackend)
+	test.Equal(t, false, NewTopicStats(nsqd.GetTopic("test#ephemeral"), nil, false).HasBackend)
+}
+
+func TestQuiet(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topic := nsqd.GetTopic("test")
+	now := time.Now()
+	test.Equal(t, false, topic.isQuiet(time.Minute, now))
+	test.Equal(t, true, topic.isQuiet(time.Minute, now.Add(2*time.Minute)))
+	test.Equal(t, false, topic.isQuiet(0, now.Add(2*time.Minute)))
+
+	topic.createdAt = now.Add(-time.Hour)
+	topic.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+	stats := NewTopicStats(topic, nil, false)
+	test.Equal(t, false, stats.Quiet)
+	test.NotEqual(t, int64(0), stats.LastMessageTimestamp)
+	test.Equal(t, true, topic.isQuiet(time.Minute, now.Add(2*time.Minute)))
+}
+
+func TestMemQueueFullCount(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	opts.MemQueueSize = 1
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_mem_queue_full" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+
+	// without any channels nothing drains the memory queue
+	for i := 0; i < 3; i++ {
+		msg := NewMessage(topic.GenerateID(), []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaa"))
+		err := topic.PutMessage(msg)
+		test.Nil(t, err)
+	}
+
+	stats := nsqd.GetStats(topicName, "")
+	test.Equal(t, uint64(2), stats[0].MemQueueFullCount)
+	test.Equal(t, int64(2), stats[0].BackendDepth)
+}
+
+func TestMessageSizeStats(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_message_size" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+
+	topic.PutMessage(NewMessage(topic.GenerateID(), make([]byte, 10)))
+	topic.PutMessages([]*Message{
+		NewMessage(topic.GenerateID(), make([]byte, 20)),
+		NewMessage(topic.GenerateID(), make([]byte, 60)),
+	})
+
+	stats := nsqd.GetStats(topicName, "")
+	test.Equal(t, int64(30), stats[0].AvgMessageSizeBytes)
+	test.Equal(t, int64(60), stats[0].MaxMessageSizeBytes)
+}
+
+func TestMPubBatchSizeStats(t *testing.T) {
+	opts := NewOptions()
+	opts.Logger = test.NewTestLogger(t)
+	_, _, nsqd := mustStartNSQD(opts)
+	defer os.RemoveAll(opts.DataPath)
+	defer nsqd.Exit()
+
+	topicName := "test_mpub_batch_size" + strconv.Itoa(int(time.Now().Unix()))
+	topic := nsqd.GetTopic(topicName)
+
+	for _, n := range []int{2, 4, 9} {
+		msgs := make([]*Message, 0, n)
+		for i := 0; i < n; i++ {
+			msgs = append(msgs, NewMessage(topic.GenerateID(), []byte("test")))
+		}
+		topic.PutMessages(msgs)
+	}
+	// single PUBs are not batches
+	topic.PutMessage(NewMessage(topic.GenerateID(), []byte("test")))
+
+	stats := nsqd.GetStats(topicName, "")
+	test.Equal(t, BatchSizeStats{Count: 3, Avg: 5, Max: 9}, stats[0].MPubBatchSize)
+}
+
 func BenchmarkTopicPut(b *testing.B) {
 	b.StopTimer()
 	topicName := "bench_topic_put" + strconv.Itoa(b.N)